@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/user"
+)
+
+// 账号等级对应的上传限制
+type AccountLimits struct {
+	Name         string // 会员类型名称
+	MaxChunkSize int64  // 允许的最大分片大小
+	MaxFileSize  int64  // 单文件大小上限
+}
+
+// 不同会员类型的上传限制，参见百度网盘开放平台上传文档
+var accountLimits = map[int]AccountLimits{
+	user.VipTypeNormal: {Name: "普通用户", MaxChunkSize: 4 * 1024 * 1024, MaxFileSize: 4 * 1024 * 1024 * 1024},
+	user.VipTypeVip:    {Name: "普通会员", MaxChunkSize: 16 * 1024 * 1024, MaxFileSize: 10 * 1024 * 1024 * 1024},
+	user.VipTypeSVip:   {Name: "超级会员", MaxChunkSize: 32 * 1024 * 1024, MaxFileSize: 20 * 1024 * 1024 * 1024},
+}
+
+// 用户信息接口使用的SDK客户端，加载配置后重新创建
+var userClient = user.NewClient()
+
+// 根据会员类型获取上传限制，未知类型按普通用户处理
+func limitsForVipType(vipType int) AccountLimits {
+	if limits, ok := accountLimits[vipType]; ok {
+		return limits
+	}
+	return accountLimits[user.VipTypeNormal]
+}
+
+// 查询当前账号的会员类型和对应的上传限制
+func queryAccountLimits(ctx context.Context) (AccountLimits, error) {
+	var info user.InfoReturn
+	err := withToken(func(accessToken string) (err error) {
+		info, err = userClient.InfoWithContext(ctx, accessToken)
+		return err
+	})
+	if err != nil {
+		return AccountLimits{}, fmt.Errorf("获取用户信息失败: %w", err)
+	}
+	return limitsForVipType(info.VipType), nil
+}
+
+// 确定分片大小：未指定时使用账号允许的最大分片，指定时校验是否在账号允许的范围内
+func resolveChunkSize(limits AccountLimits, chunkSizeMB int) (int64, error) {
+	if chunkSizeMB <= 0 {
+		return limits.MaxChunkSize, nil
+	}
+
+	chunkSize := int64(chunkSizeMB) * 1024 * 1024
+	if chunkSize < ChunkSize {
+		return 0, fmt.Errorf("分片大小不能小于 %s", formatFileSize(ChunkSize))
+	}
+	if chunkSize > limits.MaxChunkSize {
+		return 0, fmt.Errorf("%s的分片大小上限为 %s，不能使用 %s", limits.Name, formatFileSize(limits.MaxChunkSize), formatFileSize(chunkSize))
+	}
+	return chunkSize, nil
+}
+
+// 检查文件大小是否超过账号的单文件上限
+func checkFileSizeLimit(size int64, opts *UploadOptions) error {
+	if opts.MaxFileSize > 0 && size > opts.MaxFileSize {
+		return fmt.Errorf("文件大小 %s 超过%s的单文件上限 %s", formatFileSize(size), opts.AccountName, formatFileSize(opts.MaxFileSize))
+	}
+	return nil
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"bddisk_uploader/logger"
@@ -17,11 +24,17 @@ import (
 const (
 	AuthURL            = "https://openapi.baidu.com/oauth/2.0/authorize"
 	TokenURL           = "https://openapi.baidu.com/oauth/2.0/token"
+	DeviceCodeURL      = "https://openapi.baidu.com/oauth/2.0/device/code"
 	DefaultRedirectURI = "http://localhost:8080/callback"
 	DefaultScope       = "basic,netdisk"
 	CallbackPath       = "/callback"
+	// OAuth接口的超时时间，刷新token时持有凭据锁，需要远小于 staleLockAge
+	oauthTimeout = 15 * time.Second
 )
 
+// OAuth接口使用的HTTP客户端
+var oauthClient = &http.Client{Timeout: oauthTimeout}
+
 // 授权响应结构体
 type TokenResponse struct {
 	AccessToken      string `json:"access_token"`
@@ -34,6 +47,18 @@ type TokenResponse struct {
 	ErrorDescription string `json:"error_description,omitempty"`
 }
 
+// 设备码授权的响应
+type DeviceCodeResponse struct {
+	DeviceCode       string `json:"device_code"`
+	UserCode         string `json:"user_code"`
+	VerificationURL  string `json:"verification_url"`
+	QrcodeURL        string `json:"qrcode_url"`
+	ExpiresIn        int    `json:"expires_in"`
+	Interval         int    `json:"interval"`
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
 // OAuth配置
 type OAuthConfig struct {
 	ClientID     string `json:"client_id"`
@@ -42,13 +67,14 @@ type OAuthConfig struct {
 	Scope        string `json:"scope"`
 }
 
-// 生成授权URL
-func generateAuthURL(config *OAuthConfig) string {
+// 生成授权URL，state会在回调时原样返回
+func generateAuthURL(config *OAuthConfig, state string) string {
 	params := url.Values{}
 	params.Set("response_type", "code")
 	params.Set("client_id", config.ClientID)
 	params.Set("redirect_uri", config.RedirectURI)
 	params.Set("scope", config.Scope)
+	params.Set("state", state)
 
 	return AuthURL + "?" + params.Encode()
 }
@@ -62,7 +88,7 @@ func getAccessToken(config *OAuthConfig, authCode string) (*TokenResponse, error
 	params.Set("client_secret", config.ClientSecret)
 	params.Set("redirect_uri", config.RedirectURI)
 
-	resp, err := http.PostForm(TokenURL, params)
+	resp, err := oauthClient.PostForm(TokenURL, params)
 	if err != nil {
 		return nil, fmt.Errorf("请求token失败: %v", err)
 	}
@@ -93,7 +119,7 @@ func refreshAccessToken(config *OAuthConfig, refreshToken string) (*TokenRespons
 	params.Set("client_id", config.ClientID)
 	params.Set("client_secret", config.ClientSecret)
 
-	resp, err := http.PostForm(TokenURL, params)
+	resp, err := oauthClient.PostForm(TokenURL, params)
 	if err != nil {
 		return nil, fmt.Errorf("刷新token失败: %v", err)
 	}
@@ -116,90 +142,308 @@ func refreshAccessToken(config *OAuthConfig, refreshToken string) (*TokenRespons
 	return &tokenResp, nil
 }
 
-// 启动HTTP服务器接收授权回调
-func startAuthServer(config *OAuthConfig, port int) (*TokenResponse, error) {
-	authURL := generateAuthURL(config)
+// 生成随机的state参数，回调时校验以防止CSRF
+func newOAuthState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成state失败: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 从授权回调的参数中取出授权码，state不一致时返回错误
+func parseAuthCallback(query url.Values, state string) (string, error) {
+	if errorParam := query.Get("error"); errorParam != "" {
+		return "", fmt.Errorf("授权失败: %s - %s", errorParam, query.Get("error_description"))
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		return "", errInvalidState
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("未获取到授权码")
+	}
+	return code, nil
+}
+
+var errInvalidState = errors.New("state参数不匹配，请使用本次输出的授权链接重新授权")
+
+const authSuccessPage = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>授权成功</title>
+    <style>
+        body { font-family: Arial, sans-serif; text-align: center; padding: 50px; }
+        .success { color: #4CAF50; }
+    </style>
+</head>
+<body>
+    <h1 class="success">✅ 授权成功！</h1>
+    <p>请返回终端查看结果，您可以关闭此页面。</p>
+</body>
+</html>`
+
+// 启动HTTP服务器接收授权回调，ctx取消或5分钟内未完成授权时返回错误
+func startAuthServer(ctx context.Context, config *OAuthConfig, port int) (*TokenResponse, error) {
+	state, err := newOAuthState()
+	if err != nil {
+		return nil, err
+	}
+	authURL := generateAuthURL(config, state)
 	logger.Info("请在浏览器中打开以下URL进行授权:\n%s", authURL)
 	logger.Info("等待授权回调...")
 
 	tokenChan := make(chan *TokenResponse, 1)
 	errChan := make(chan error, 1)
-
-	server := &http.Server{
-		Addr: ":" + strconv.Itoa(port),
+	sendErr := func(err error) {
+		select {
+		case errChan <- err:
+		default:
+		}
 	}
 
-	http.HandleFunc(CallbackPath, func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		errorParam := r.URL.Query().Get("error")
-
-		if errorParam != "" {
-			errDesc := r.URL.Query().Get("error_description")
-			errChan <- fmt.Errorf("授权失败: %s - %s", errorParam, errDesc)
-			fmt.Fprintf(w, "授权失败: %s", errorParam)
+	// 使用独立的ServeMux，同一进程中可以多次授权
+	mux := http.NewServeMux()
+	mux.HandleFunc(CallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		code, err := parseAuthCallback(r.URL.Query(), state)
+		if errors.Is(err, errInvalidState) {
+			// 可能是伪造的请求，继续等待正确的回调
+			logger.Warn("收到state不匹配的授权回调，已忽略")
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-
-		if code == "" {
-			errChan <- fmt.Errorf("未获取到授权码")
-			fmt.Fprintf(w, "未获取到授权码")
+		if err != nil {
+			sendErr(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		logger.Debug("收到授权码: %s", code)
 		logger.Info("正在获取access_token...")
-
 		tokenResp, err := getAccessToken(config, code)
 		if err != nil {
-			errChan <- err
-			fmt.Fprintf(w, "获取access_token失败: %v", err)
+			sendErr(err)
+			http.Error(w, "获取access_token失败，请查看命令行输出", http.StatusInternalServerError)
 			return
 		}
 
-		tokenChan <- tokenResp
-		fmt.Fprintf(w, `
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>授权成功</title>
-    <style>
-        body { font-family: Arial, sans-serif; text-align: center; padding: 50px; }
-        .success { color: #4CAF50; }
-        .token { background: #f5f5f5; padding: 10px; margin: 20px 0; word-break: break-all; }
-    </style>
-</head>
-<body>
-    <h1 class="success">✅ 授权成功！</h1>
-    <p>Access Token已获取，您可以关闭此页面。</p>
-    <div class="token">
-        <strong>Access Token:</strong><br>
-        %s
-    </div>
-    <p><em>程序将自动保存token到配置文件中。</em></p>
-</body>
-</html>`, tokenResp.AccessToken)
+		select {
+		case tokenChan <- tokenResp:
+		default:
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, authSuccessPage)
 	})
 
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			errChan <- fmt.Errorf("启动服务器失败: %v", err)
+			sendErr(fmt.Errorf("启动服务器失败: %v（无法接收回调时可以使用 -auth -paste）", err))
 		}
 	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
 
 	// 等待授权结果或超时
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
 	select {
 	case token := <-tokenChan:
-		server.Shutdown(ctx)
 		return token, nil
 	case err := <-errChan:
-		server.Shutdown(ctx)
 		return nil, err
 	case <-ctx.Done():
-		server.Shutdown(ctx)
-		return nil, fmt.Errorf("授权超时（5分钟）")
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("授权超时（5分钟）")
+		}
+		return nil, ctx.Err()
 	}
 }
+
+// 不启动回调服务器，授权后将浏览器地址栏中的完整回调地址粘贴到命令行
+func startPasteAuth(config *OAuthConfig, input io.Reader) (*TokenResponse, error) {
+	state, err := newOAuthState()
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("请在浏览器中打开以下URL进行授权:\n%s", generateAuthURL(config, state))
+	logger.Info("授权后浏览器会跳转到 %s（页面打不开也没关系），请复制地址栏中的完整地址粘贴到这里并回车:", config.RedirectURI)
+
+	line, err := bufio.NewReader(input).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("读取回调地址失败: %v", err)
+	}
+	redirectURL, err := url.Parse(strings.TrimSpace(line))
+	if err != nil || redirectURL.RawQuery == "" {
+		return nil, fmt.Errorf("无效的回调地址，请粘贴包含 code 和 state 参数的完整地址")
+	}
+	code, err := parseAuthCallback(redirectURL.Query(), state)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("正在获取access_token...")
+	return getAccessToken(config, code)
+}
+
+// 设备码授权轮询间隔
+const (
+	DefaultDevicePollInterval = 5 * time.Second
+	MaxDevicePollInterval     = time.Minute
+)
+
+// 向OAuth接口发送表单请求并解析JSON响应
+func postOAuthForm(ctx context.Context, endpoint string, params url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("解析响应失败: %v (HTTP %d)", err, resp.StatusCode)
+	}
+	return nil
+}
+
+// 获取设备码和用户码
+func requestDeviceCode(ctx context.Context, config *OAuthConfig) (*DeviceCodeResponse, error) {
+	params := url.Values{}
+	params.Set("response_type", "device_code")
+	params.Set("client_id", config.ClientID)
+	params.Set("scope", config.Scope)
+
+	var deviceResp DeviceCodeResponse
+	if err := postOAuthForm(ctx, DeviceCodeURL, params, &deviceResp); err != nil {
+		return nil, fmt.Errorf("获取设备码失败: %w", err)
+	}
+	if deviceResp.Error != "" {
+		return nil, fmt.Errorf("获取设备码失败: %s - %s", deviceResp.Error, deviceResp.ErrorDescription)
+	}
+	if deviceResp.DeviceCode == "" || deviceResp.UserCode == "" {
+		return nil, fmt.Errorf("获取设备码失败: 响应中缺少device_code或user_code")
+	}
+	return &deviceResp, nil
+}
+
+// 输出用户码和授权地址，标准输出是终端时同时输出二维码
+func printDeviceCode(deviceResp *DeviceCodeResponse) {
+	verificationURL := deviceResp.VerificationURL
+	if verificationURL == "" {
+		verificationURL = "https://openapi.baidu.com/device"
+	}
+	fmt.Printf("\n请在任意设备的浏览器中打开: %s\n", verificationURL)
+	fmt.Printf("并输入用户码: %s\n\n", deviceResp.UserCode)
+
+	if stat, err := os.Stdout.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		qr, err := encodeQRCode(verificationURL + "?code=" + url.QueryEscape(deviceResp.UserCode))
+		if err == nil {
+			fmt.Println("或使用百度网盘App扫描二维码:")
+			qr.print(os.Stdout)
+			fmt.Println()
+		} else {
+			logger.Debug("生成二维码失败: %v", err)
+		}
+	}
+	if deviceResp.QrcodeURL != "" {
+		fmt.Printf("二维码图片: %s\n\n", deviceResp.QrcodeURL)
+	}
+}
+
+// 轮询token接口直到用户完成授权、拒绝授权或设备码过期
+func pollDeviceToken(ctx context.Context, config *OAuthConfig, deviceResp *DeviceCodeResponse) (*TokenResponse, error) {
+	interval := time.Duration(deviceResp.Interval) * time.Second
+	if interval <= 0 {
+		interval = DefaultDevicePollInterval
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", "device_token")
+	params.Set("code", deviceResp.DeviceCode)
+	params.Set("client_id", config.ClientID)
+	params.Set("client_secret", config.ClientSecret)
+
+	wait := interval
+	for {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, fmt.Errorf("设备码已过期，请重新运行 -auth -device")
+			}
+			return nil, ctx.Err()
+		}
+
+		var tokenResp TokenResponse
+		if err := postOAuthForm(ctx, TokenURL, params, &tokenResp); err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			// 网络错误时逐步延长间隔后继续轮询
+			wait *= 2
+			if wait > MaxDevicePollInterval {
+				wait = MaxDevicePollInterval
+			}
+			logger.Warn("查询授权结果失败，%s 后重试: %v", formatDuration(wait), err)
+			continue
+		}
+		wait = interval
+
+		switch tokenResp.Error {
+		case "":
+			if tokenResp.AccessToken == "" {
+				return nil, fmt.Errorf("获取token失败: 响应中缺少access_token")
+			}
+			return &tokenResp, nil
+		case "authorization_pending":
+			logger.Debug("等待用户授权...")
+		case "slow_down":
+			// 服务端要求降低轮询频率
+			interval += DefaultDevicePollInterval
+			wait = interval
+			logger.Debug("轮询过快，间隔调整为 %s", formatDuration(interval))
+		case "expired_token":
+			return nil, fmt.Errorf("设备码已过期，请重新运行 -auth -device")
+		case "authorization_declined", "access_denied":
+			return nil, fmt.Errorf("用户拒绝了授权")
+		default:
+			return nil, fmt.Errorf("获取token失败: %s - %s", tokenResp.Error, tokenResp.ErrorDescription)
+		}
+	}
+}
+
+// 设备码授权：无需本机浏览器，在其他设备上输入用户码或扫码完成授权
+func startDeviceAuth(ctx context.Context, config *OAuthConfig) (*TokenResponse, error) {
+	deviceResp, err := requestDeviceCode(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	printDeviceCode(deviceResp)
+
+	expiresIn := time.Duration(deviceResp.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 5 * time.Minute
+	}
+	logger.Info("等待授权（%s 内有效）...", formatDuration(expiresIn))
+	ctx, cancel := context.WithTimeout(ctx, expiresIn)
+	defer cancel()
+	return pollDeviceToken(ctx, config, deviceResp)
+}
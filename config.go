@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bddisk_uploader/logger"
+)
+
+// 用户配置目录下的子目录，Linux上为 $XDG_CONFIG_HOME/bddisk_uploader
+const ConfigDirName = "bddisk_uploader"
+
+// -config 参数指定的配置文件路径
+var configFlag string
+
+// 配置文件的查找位置，按优先级排列：-config 参数、BDDISK_CONFIG 环境变量、用户配置目录、当前目录
+func configSearchPaths() []string {
+	if configFlag != "" {
+		return []string{configFlag}
+	}
+	if p := os.Getenv("BDDISK_CONFIG"); p != "" {
+		return []string{p}
+	}
+	var paths []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, ConfigDirName, ConfigFile))
+	}
+	return append(paths, ConfigFile)
+}
+
+// 使用的配置文件：查找位置中第一个存在的文件，都不存在时为当前目录下的 config.json
+func configFilePath() string {
+	paths := configSearchPaths()
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return paths[len(paths)-1]
+}
+
+// 配置项：config get/set/unset 使用的名称、覆盖它的环境变量和设置时的校验
+type configKey struct {
+	name   string
+	env    string
+	secret bool                         // 保存在凭据存储中，输出时隐藏
+	field  func(c *Config) *string      // 配置中的字段
+	cred   func(c *Credentials) *string // secret配置项在凭据存储中的字段
+	check  func(value string) error     // 设置时校验，为nil时不校验
+}
+
+var configKeys = []configKey{
+	{name: "app_path", env: "BDDISK_APP_PATH", field: func(c *Config) *string { return &c.AppPath }, check: checkAppPath},
+	{name: "api_host", env: "BDDISK_API_HOST", field: func(c *Config) *string { return &c.APIHost }, check: checkHostURL},
+	{name: "upload_host", env: "BDDISK_UPLOAD_HOST", field: func(c *Config) *string { return &c.UploadHost }, check: checkHostURL},
+	{name: "credential_helper", field: func(c *Config) *string { return &c.CredentialHelper }},
+	{name: "oauth.client_id", env: "BDDISK_CLIENT_ID", field: func(c *Config) *string { return &c.oauth().ClientID }},
+	{name: "oauth.client_secret", env: "BDDISK_CLIENT_SECRET", secret: true,
+		field: func(c *Config) *string { return &c.oauth().ClientSecret },
+		cred:  func(c *Credentials) *string { return &c.ClientSecret }},
+	{name: "oauth.redirect_uri", env: "BDDISK_REDIRECT_URI", field: func(c *Config) *string { return &c.oauth().RedirectURI }, check: checkRedirectURI},
+	{name: "oauth.scope", env: "BDDISK_SCOPE", field: func(c *Config) *string { return &c.oauth().Scope }},
+	{name: "access_token", env: "BDDISK_ACCESS_TOKEN", secret: true,
+		field: func(c *Config) *string { return &c.AccessToken },
+		cred:  func(c *Credentials) *string { return &c.AccessToken }},
+	{name: "refresh_token", env: "BDDISK_REFRESH_TOKEN", secret: true,
+		field: func(c *Config) *string { return &c.RefreshToken },
+		cred:  func(c *Credentials) *string { return &c.RefreshToken }},
+	{name: "serve_token", env: "BDDISK_SERVE_TOKEN", secret: true,
+		field: func(c *Config) *string { return &c.ServeToken },
+		cred:  func(c *Credentials) *string { return &c.ServeToken }},
+}
+
+// 覆盖access_token过期时间的环境变量
+const expiresAtEnv = "BDDISK_EXPIRES_AT"
+
+// 按名称查找配置项
+func findConfigKey(name string) (*configKey, error) {
+	names := make([]string, 0, len(configKeys))
+	for i := range configKeys {
+		if configKeys[i].name == name {
+			return &configKeys[i], nil
+		}
+		names = append(names, configKeys[i].name)
+	}
+	return nil, fmt.Errorf("未知的配置项 %s（可用: %s）", name, strings.Join(names, ", "))
+}
+
+// 返回OAuth配置，不存在时创建默认配置
+func (c *Config) oauth() *OAuthConfig {
+	if c.OAuth == nil {
+		c.OAuth = &OAuthConfig{RedirectURI: DefaultRedirectURI, Scope: DefaultScope}
+	}
+	return c.OAuth
+}
+
+// 是否设置了任何覆盖配置的环境变量
+func hasConfigEnv() bool {
+	return len(configEnvInUse()) > 0 || os.Getenv(expiresAtEnv) != ""
+}
+
+// 已设置的覆盖配置的环境变量
+func configEnvInUse() []string {
+	var names []string
+	for _, k := range configKeys {
+		if k.env != "" && os.Getenv(k.env) != "" {
+			names = append(names, k.env)
+		}
+	}
+	return names
+}
+
+// 使用环境变量覆盖配置，只影响本次运行，不会写回配置文件
+func applyConfigEnv(config *Config) error {
+	for _, k := range configKeys {
+		if k.env == "" {
+			continue
+		}
+		if value := os.Getenv(k.env); value != "" {
+			*k.field(config) = value
+		}
+	}
+	if value := os.Getenv(expiresAtEnv); value != "" {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return fmt.Errorf("环境变量 %s 无效: 格式应为RFC3339，如 2006-01-02T15:04:05+08:00", expiresAtEnv)
+		}
+		config.ExpiresAt = &expiresAt
+	}
+	return nil
+}
+
+// 当前的配置文件格式版本，没有version字段的旧配置文件为版本0
+const configVersion = 1
+
+// 配置文件格式的迁移，configMigrations[i] 将版本i的配置升级到版本i+1，直接修改解析后的JSON对象。
+// 修改配置文件格式时增加 configVersion，并在末尾添加对应的迁移
+var configMigrations = []func(raw map[string]interface{}) error{
+	// 0 -> 1: token改为保存在凭据存储中，删除 -init 生成的空token字段和占位符
+	func(raw map[string]interface{}) error {
+		forEachRawProfile(raw, func(profile map[string]interface{}) {
+			for _, key := range []string{"access_token", "refresh_token", "expires_at"} {
+				if value, ok := profile[key]; ok && (value == nil || value == "" || value == "your_access_token_here") {
+					delete(profile, key)
+				}
+			}
+		})
+		return nil
+	},
+}
+
+// 对配置文件顶层（default profile）和每个profile调用fn
+func forEachRawProfile(raw map[string]interface{}, fn func(profile map[string]interface{})) {
+	fn(raw)
+	profiles, _ := raw["profiles"].(map[string]interface{})
+	for _, p := range profiles {
+		if profile, ok := p.(map[string]interface{}); ok {
+			fn(profile)
+		}
+	}
+}
+
+// 将配置文件升级到当前版本，返回升级后的内容和原来的版本
+func migrateConfig(configData []byte) ([]byte, int, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(configData, &raw); err != nil {
+		return nil, 0, jsonError(configData, err)
+	}
+	version := 0
+	if v, ok := raw["version"].(float64); ok {
+		version = int(v)
+	}
+	if version > configVersion {
+		return nil, version, fmt.Errorf("配置文件版本为 %d，当前程序只支持到版本 %d，请升级程序", version, configVersion)
+	}
+	if version == configVersion {
+		return configData, version, nil
+	}
+	for v := version; v < configVersion; v++ {
+		if err := configMigrations[v](raw); err != nil {
+			return nil, version, fmt.Errorf("配置文件从版本 %d 升级失败: %v", v, err)
+		}
+	}
+	raw["version"] = configVersion
+	migrated, err := json.Marshal(raw)
+	return migrated, version, err
+}
+
+// 为JSON解析错误加上出错的行号、列号或字段名
+func jsonError(data []byte, err error) error {
+	lineCol := func(offset int64) string {
+		if offset < 0 {
+			offset = 0
+		}
+		if offset > int64(len(data)) {
+			offset = int64(len(data))
+		}
+		before := data[:offset]
+		line := strings.Count(string(before), "\n") + 1
+		col := len(before) - strings.LastIndex(string(before), "\n")
+		return fmt.Sprintf("第%d行第%d列", line, col)
+	}
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		// Offset为已读取的字节数，出错的字符是最后读取的一个
+		return fmt.Errorf("%s: %v", lineCol(e.Offset-1), err)
+	case *json.UnmarshalTypeError:
+		return fmt.Errorf("字段 %s 的值应为%s类型，实际为%s", e.Field, e.Type, e.Value)
+	}
+	return err
+}
+
+// 设置app_path时的校验：百度网盘只允许应用写入 /apps/<应用名>/ 下
+func checkAppPath(value string) error {
+	if value == "" {
+		return fmt.Errorf("不能为空")
+	}
+	if !strings.HasPrefix(value, "/apps/") {
+		return fmt.Errorf("必须以 /apps/<应用名>/ 开头，应用只能访问自己的目录")
+	}
+	for _, part := range strings.Split(value, "/") {
+		if part == ".." || part == "." {
+			return fmt.Errorf("不能包含 . 或 .. 路径")
+		}
+	}
+	if app := path.Clean(value); app == "/apps" {
+		return fmt.Errorf("缺少应用名，应为 /apps/<应用名>/")
+	} else if app == "/apps/your_app_name" {
+		return fmt.Errorf("仍是示例值，请改为 /apps/<你的应用名>/")
+	}
+	return nil
+}
+
+// api_host和upload_host为 pan.baidu.com 或 https://pan.baidu.com 这样的地址，省略协议时使用https
+func checkHostURL(value string) error {
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("应为 pan.baidu.com 或 https://pan.baidu.com 这样的地址")
+	}
+	return nil
+}
+
+// redirect_uri为 oob 或带端口的本地回调地址
+func checkRedirectURI(value string) error {
+	if value == "oob" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("应为 oob 或 http://localhost:8080/callback 这样的地址")
+	}
+	return nil
+}
+
+// 检查配置，返回所有问题。needToken为true时检查access_token，needOAuth为true时检查OAuth应用信息
+func configProblems(config *Config, needToken, needOAuth bool) []string {
+	var problems []string
+	add := func(name, value, reason string) {
+		problem := name
+		if value != "" {
+			problem += fmt.Sprintf(" %q", redactConfigValue(name, value))
+		}
+		problem += ": " + reason
+		if k, err := findConfigKey(name); err == nil && k.env != "" && os.Getenv(k.env) != "" {
+			problem += "（来自环境变量 " + k.env + "）"
+		}
+		problems = append(problems, problem)
+	}
+
+	for _, k := range configKeys {
+		if k.check == nil {
+			continue
+		}
+		value := *k.field(config)
+		if value == "" && k.name != "app_path" {
+			continue
+		}
+		if err := k.check(value); err != nil {
+			add(k.name, value, err.Error())
+		}
+	}
+
+	oauthUsable := config.OAuth != nil && config.OAuth.ClientID != "" && config.OAuth.ClientID != "your_app_key_here" &&
+		realClientSecret(config.OAuth.ClientSecret)
+	if needOAuth {
+		switch {
+		case config.OAuth == nil:
+			add("oauth", "", "缺少OAuth应用信息（client_id、client_secret），请运行 -init 生成")
+		default:
+			if config.OAuth.ClientID == "" || config.OAuth.ClientID == "your_app_key_here" {
+				add("oauth.client_id", config.OAuth.ClientID, "请设置为开放平台应用的App Key")
+			}
+			if !realClientSecret(config.OAuth.ClientSecret) {
+				add("oauth.client_secret", "", "请设置为开放平台应用的Secret Key")
+			}
+		}
+	}
+
+	if needToken {
+		switch {
+		case config.AccessToken == "" || config.AccessToken == "your_access_token_here":
+			add("access_token", "", "尚未授权，请先运行: ./bddisk_uploader -auth"+profileFlagHint())
+		case config.ExpiresAt != nil && time.Now().After(*config.ExpiresAt) && config.RefreshToken == "":
+			add("access_token", "", fmt.Sprintf("已于 %s 过期且没有refresh_token，请重新运行 -auth%s",
+				config.ExpiresAt.Local().Format("2006-01-02 15:04"), profileFlagHint()))
+		case config.ExpiresAt != nil && time.Now().After(*config.ExpiresAt) && !oauthUsable:
+			add("access_token", "", fmt.Sprintf("已于 %s 过期，自动刷新需要oauth.client_id和oauth.client_secret",
+				config.ExpiresAt.Local().Format("2006-01-02 15:04")))
+		}
+	}
+	return problems
+}
+
+// 检查配置，有问题时返回列出所有问题的错误
+func validateConfig(config *Config, needToken, needOAuth bool) error {
+	problems := configProblems(config, needToken, needOAuth)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("配置有误（%s，profile %s）:\n  - %s", configFilePath(), currentProfile(), strings.Join(problems, "\n  - "))
+}
+
+// 输出时隐藏secret配置项，只保留前4个字符
+func redactConfigValue(name, value string) string {
+	if k, err := findConfigKey(name); err != nil || !k.secret || value == "" {
+		return value
+	}
+	if len(value) <= 8 {
+		return "****"
+	}
+	return value[:4] + "****"
+}
+
+// config show|get|set|unset
+func runConfig(args []string) int {
+	if err := logger.InitWithConsole(logger.INFO, os.Stderr, "", false); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	usage := fmt.Errorf("用法: ./bddisk_uploader config show|get|set|unset [-config 路径] [-profile 名称] [配置项] [值]")
+	if len(args) == 0 {
+		return commandFailed(context.Background(), usage)
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("config "+action, flag.ExitOnError)
+	addConfigFlags(fs)
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出（show）")
+	reveal := fs.Bool("reveal", false, "输出token和client_secret的完整值（show、get）")
+	if err := fs.Parse(args[1:]); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+
+	switch action {
+	case "show":
+		return showConfig(*jsonOutput, *reveal)
+
+	case "get":
+		if fs.NArg() != 1 {
+			return commandFailed(context.Background(), fmt.Errorf("用法: ./bddisk_uploader config get [-reveal] <配置项>"))
+		}
+		config, err := loadProfileConfig()
+		if err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		if fs.Arg(0) == "expires_at" {
+			if config.ExpiresAt != nil {
+				fmt.Println(config.ExpiresAt.Format(time.RFC3339))
+			}
+			return 0
+		}
+		k, err := findConfigKey(fs.Arg(0))
+		if err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		value := *k.field(config)
+		if !*reveal {
+			value = redactConfigValue(k.name, value)
+		}
+		fmt.Println(value)
+		return 0
+
+	case "set", "unset":
+		if action == "set" && fs.NArg() != 2 || action == "unset" && fs.NArg() != 1 {
+			return commandFailed(context.Background(), fmt.Errorf("用法: ./bddisk_uploader config set <配置项> <值> 或 config unset <配置项>"))
+		}
+		k, err := findConfigKey(fs.Arg(0))
+		if err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		value := fs.Arg(1)
+		if action == "set" {
+			if value == "" {
+				return commandFailed(context.Background(), fmt.Errorf("值不能为空，清除配置项请使用 config unset %s", k.name))
+			}
+			if k.check != nil {
+				if err := k.check(value); err != nil {
+					return commandFailed(context.Background(), fmt.Errorf("%s %q 无效: %v", k.name, redactConfigValue(k.name, value), err))
+				}
+			}
+		}
+		if err := setConfigValue(k, value); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		if action == "set" {
+			logger.Info("profile %s 的 %s 已设置为 %s", currentProfile(), k.name, redactConfigValue(k.name, value))
+		} else {
+			logger.Info("profile %s 的 %s 已清除", currentProfile(), k.name)
+		}
+		if k.env != "" && os.Getenv(k.env) != "" {
+			logger.Warn("环境变量 %s 已设置，运行时会覆盖该配置项", k.env)
+		}
+		return 0
+	}
+	return commandFailed(context.Background(), usage)
+}
+
+// 修改当前profile的配置项，value为空时清除。token和client_secret保存到凭据存储，
+// 同时删除配置文件中旧版本保存的值，其余配置项写入配置文件
+func setConfigValue(k *configKey, value string) error {
+	data, err := readConfigFile()
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v，请先运行: ./bddisk_uploader -init", err)
+	}
+	if err != nil {
+		return err
+	}
+	profile := currentProfile()
+	config, err := data.profile(profile)
+	if err != nil {
+		return err
+	}
+
+	if !k.secret {
+		*k.field(config) = value
+		if k.name == "credential_helper" {
+			logger.Warn("已保存的token和client_secret不会自动转移到新的凭据存储，可能需要重新运行 -auth%s", profileFlagHint())
+		}
+		return writeConfigFile(data)
+	}
+
+	err = credentialStoreFor(config).update(profile, func(cred *Credentials) error {
+		*k.cred(cred) = value
+		if k.name == "access_token" {
+			// 手动设置的token过期时间未知
+			cred.ExpiresAt = nil
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *k.field(config) == "" {
+		return nil
+	}
+	*k.field(config) = ""
+	if k.name == "access_token" {
+		config.ExpiresAt = nil
+	}
+	return writeConfigFile(data)
+}
+
+// 配置信息，用于--json输出
+type ConfigInfo struct {
+	ConfigFile      string            `json:"config_file"`
+	Profile         string            `json:"profile"`
+	CredentialStore string            `json:"credential_store"`
+	Values          map[string]string `json:"values"`
+	ExpiresAt       *time.Time        `json:"expires_at,omitempty"`
+	EnvOverrides    []string          `json:"env_overrides,omitempty"`
+	Problems        []string          `json:"problems"`
+}
+
+// 输出当前profile生效的配置（合并凭据存储和环境变量后）以及检查结果
+func showConfig(jsonOutput, reveal bool) int {
+	config, err := loadProfileConfig()
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	info := ConfigInfo{
+		ConfigFile:   configFilePath(),
+		Profile:      currentProfile(),
+		Values:       make(map[string]string),
+		ExpiresAt:    config.ExpiresAt,
+		EnvOverrides: configEnvInUse(),
+		Problems:     configProblems(config, true, true),
+	}
+	if store, ok := credentialStoreFor(config).(*fileCredentialStore); ok {
+		info.CredentialStore = store.path
+	} else {
+		info.CredentialStore = "helper:" + config.CredentialHelper
+	}
+	if os.Getenv(expiresAtEnv) != "" {
+		info.EnvOverrides = append(info.EnvOverrides, expiresAtEnv)
+	}
+	for _, k := range configKeys {
+		value := *k.field(config)
+		if !reveal {
+			value = redactConfigValue(k.name, value)
+		}
+		info.Values[k.name] = value
+	}
+
+	if jsonOutput {
+		if info.Problems == nil {
+			info.Problems = []string{}
+		}
+		if err := printJSON(info); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		return 0
+	}
+	fmt.Printf("配置文件: %s\n", info.ConfigFile)
+	fmt.Printf("profile: %s\n", info.Profile)
+	if config.CredentialHelper != "" {
+		fmt.Printf("凭据程序: %s\n", config.CredentialHelper)
+	} else {
+		fmt.Printf("凭据文件: %s\n", info.CredentialStore)
+	}
+	fmt.Println()
+	for _, k := range configKeys {
+		value := info.Values[k.name]
+		if value == "" {
+			value = "(未设置)"
+		}
+		fmt.Printf("  %-20s %s\n", k.name, value)
+	}
+	expires := "(未设置)"
+	if info.ExpiresAt != nil {
+		expires = info.ExpiresAt.Local().Format("2006-01-02 15:04:05")
+		if time.Now().After(*info.ExpiresAt) {
+			expires += "（已过期）"
+		}
+	}
+	fmt.Printf("  %-20s %s\n", "expires_at", expires)
+	if len(info.EnvOverrides) > 0 {
+		fmt.Printf("\n环境变量覆盖: %s\n", strings.Join(info.EnvOverrides, ", "))
+	}
+	fmt.Println()
+	if len(info.Problems) == 0 {
+		fmt.Println("检查: 通过")
+		return 0
+	}
+	fmt.Printf("检查: 发现%d个问题\n", len(info.Problems))
+	for _, problem := range info.Problems {
+		fmt.Printf("  - %s\n", problem)
+	}
+	return 0
+}
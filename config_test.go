@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	old := `{
+  "app_path": "/apps/test/",
+  "access_token": "your_access_token_here",
+  "refresh_token": "",
+  "expires_at": null,
+  "profiles": {
+    "work": {"app_path": "/apps/work/", "access_token": "", "refresh_token": "keep"}
+  }
+}`
+	migrated, version, err := migrateConfig([]byte(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 0 {
+		t.Errorf("version = %d, want 0", version)
+	}
+	var data configFileData
+	if err := json.Unmarshal(migrated, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.Version != configVersion || data.AccessToken != "" || data.AppPath != "/apps/test/" {
+		t.Errorf("migrated = %s", migrated)
+	}
+	for _, key := range []string{"your_access_token_here", `"access_token"`, `"expires_at"`} {
+		if strings.Contains(string(migrated), key) {
+			t.Errorf("migrated config still contains %s: %s", key, migrated)
+		}
+	}
+	// 真实的token不会被迁移删除
+	if work := data.Profiles["work"]; work == nil || work.RefreshToken != "keep" {
+		t.Errorf("work profile = %+v", work)
+	}
+
+	current := []byte(`{"version":1,"app_path":"/apps/test/"}`)
+	if got, version, err := migrateConfig(current); err != nil || version != 1 || string(got) != string(current) {
+		t.Errorf("current config changed: %s, %d, %v", got, version, err)
+	}
+	if _, _, err := migrateConfig([]byte(`{"version":99}`)); err == nil || !strings.Contains(err.Error(), "请升级程序") {
+		t.Errorf("newer version error = %v", err)
+	}
+}
+
+func TestMigrateConfigSyntaxError(t *testing.T) {
+	_, _, err := migrateConfig([]byte("{\n  \"app_path\": \"/apps/test/\",\n  \"oauth\": {,}\n}"))
+	if err == nil || !strings.Contains(err.Error(), "第3行第13列") {
+		t.Errorf("error = %v, want line 3 column 13", err)
+	}
+}
+
+func TestConfigChecks(t *testing.T) {
+	for _, tc := range []struct {
+		check func(string) error
+		value string
+		ok    bool
+	}{
+		{checkAppPath, "/apps/test/", true},
+		{checkAppPath, "", false},
+		{checkAppPath, "/test/", false},
+		{checkAppPath, "/apps/", false},
+		{checkAppPath, "/apps/test/../other", false},
+		{checkAppPath, "/apps/your_app_name/", false},
+		{checkHostURL, "pan.baidu.com", true},
+		{checkHostURL, "https://pan.baidu.com", true},
+		{checkHostURL, "http://127.0.0.1:8080", true},
+		{checkHostURL, "ftp://pan.baidu.com", false},
+		{checkHostURL, "https://", false},
+		{checkRedirectURI, "oob", true},
+		{checkRedirectURI, "http://localhost:8080/callback", true},
+		{checkRedirectURI, "localhost:8080", false},
+	} {
+		if err := tc.check(tc.value); (err == nil) != tc.ok {
+			t.Errorf("check(%q) = %v, want ok=%v", tc.value, err, tc.ok)
+		}
+	}
+}
+
+func TestConfigProblems(t *testing.T) {
+	config := &Config{
+		AppPath:     "/apps/your_app_name/",
+		AccessToken: "your_access_token_here",
+		OAuth:       &OAuthConfig{ClientID: "your_app_key_here", ClientSecret: "your_secret_key_here"},
+	}
+	problems := configProblems(config, true, true)
+	if len(problems) != 4 {
+		t.Fatalf("problems = %q, want app_path, client_id, client_secret and access_token", problems)
+	}
+	for i, prefix := range []string{"app_path", "oauth.client_id", "oauth.client_secret", "access_token"} {
+		if !strings.HasPrefix(problems[i], prefix) {
+			t.Errorf("problems[%d] = %q, want %s", i, problems[i], prefix)
+		}
+	}
+	if problems := configProblems(config, false, false); len(problems) != 1 {
+		t.Errorf("problems without token and OAuth = %q", problems)
+	}
+}
+
+func TestRedactConfigValue(t *testing.T) {
+	for _, tc := range []struct{ name, value, want string }{
+		{"access_token", "121.abcdefgh", "121.****"},
+		{"oauth.client_secret", "short", "****"},
+		{"refresh_token", "", ""},
+		{"app_path", "/apps/test/", "/apps/test/"},
+	} {
+		if got := redactConfigValue(tc.name, tc.value); got != tc.want {
+			t.Errorf("redactConfigValue(%s, %q) = %q, want %q", tc.name, tc.value, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bddisk_uploader/logger"
+)
+
+const (
+	CredentialsFile       = "credentials.json" // 与配置文件在同一目录
+	credentialsVersion    = 1
+	credentialsIterations = 200000              // PBKDF2迭代次数
+	passphraseEnv         = "BDDISK_PASSPHRASE" // 加密凭据文件的口令
+)
+
+// 保存在凭据存储中的敏感信息，不再写入配置文件
+type Credentials struct {
+	AccessToken  string     `json:"access_token,omitempty"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	ClientSecret string     `json:"client_secret,omitempty"`
+	ServeToken   string     `json:"serve_token,omitempty"`
+}
+
+// 凭据文件的内容，加密时profiles序列化后加密保存在data中
+type credentialsFileData struct {
+	Version    int                     `json:"version"`
+	Encryption *credentialsEncryption  `json:"encryption,omitempty"`
+	Data       string                  `json:"data,omitempty"`
+	Profiles   map[string]*Credentials `json:"profiles,omitempty"`
+}
+
+// 加密参数：PBKDF2-HMAC-SHA256派生密钥，AES-256-GCM加密
+type credentialsEncryption struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      string `json:"nonce"`
+}
+
+// 凭据存储：默认为配置文件旁的凭据文件，配置了 credential_helper 时交给外部程序保存
+type credentialStore interface {
+	// 读取profile的凭据，不存在时返回nil
+	get(profile string) (*Credentials, error)
+	// 读取、修改并保存profile的凭据，文件存储在此期间持有锁
+	update(profile string, fn func(cred *Credentials) error) error
+	// 删除profile的凭据
+	erase(profile string) error
+}
+
+// 配置使用的凭据存储
+func credentialStoreFor(config *Config) credentialStore {
+	if config.CredentialHelper != "" {
+		return &helperCredentialStore{helper: config.CredentialHelper}
+	}
+	return &fileCredentialStore{path: credentialsFilePath()}
+}
+
+// 配置使用的凭据存储的说明，用于提示token保存到了哪里
+func credentialStoreName(config *Config) string {
+	if config.CredentialHelper != "" {
+		return "凭据程序 " + config.CredentialHelper
+	}
+	return "凭据文件 " + credentialsFilePath()
+}
+
+// 凭据文件路径：config.json 对应 credentials.json，其他配置文件名对应 <名称>.credentials.json
+func credentialsFilePath() string {
+	configPath := configFilePath()
+	name := CredentialsFile
+	if base := filepath.Base(configPath); base != ConfigFile {
+		name = strings.TrimSuffix(base, filepath.Ext(base)) + "." + CredentialsFile
+	}
+	return filepath.Join(filepath.Dir(configPath), name)
+}
+
+// client_secret是否为真实的值（不是 -init 生成的占位符）
+func realClientSecret(secret string) bool {
+	return secret != "" && secret != "your_secret_key_here"
+}
+
+// 从凭据存储读取token和client_secret，覆盖配置文件中旧版本保存的值
+func loadCredentials(profile string, config *Config) error {
+	cred, err := credentialStoreFor(config).get(profile)
+	if err != nil {
+		return fmt.Errorf("读取凭据失败: %v", err)
+	}
+	if cred == nil {
+		return nil
+	}
+	if cred.AccessToken != "" {
+		config.AccessToken = cred.AccessToken
+		config.RefreshToken = cred.RefreshToken
+		config.ExpiresAt = cred.ExpiresAt
+	}
+	if cred.ClientSecret != "" {
+		config.oauth().ClientSecret = cred.ClientSecret
+	}
+	if cred.ServeToken != "" {
+		config.ServeToken = cred.ServeToken
+	}
+	return nil
+}
+
+// 获取新token并保存到当前profile的凭据存储，返回保存后的凭据。
+// obtain 在持有凭据锁时调用，stored为存储中现有的凭据，返回nil表示直接使用现有的token；
+// 配置文件中旧版本保存的token和client_secret会移到凭据存储中
+func updateStoredToken(obtain func(stored *Credentials) (*TokenResponse, error)) (*Credentials, error) {
+	data, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	profile := currentProfile()
+	config, err := data.profile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	moveSecret := config.OAuth != nil && realClientSecret(config.OAuth.ClientSecret)
+	var result Credentials
+	err = credentialStoreFor(config).update(profile, func(cred *Credentials) error {
+		if cred.AccessToken == "" && config.AccessToken != "" && config.AccessToken != "your_access_token_here" {
+			cred.AccessToken = config.AccessToken
+			cred.RefreshToken = config.RefreshToken
+			cred.ExpiresAt = config.ExpiresAt
+		}
+		tokenResp, err := obtain(cred)
+		if err != nil {
+			return err
+		}
+		if tokenResp != nil {
+			cred.setToken(tokenResp)
+		}
+		if moveSecret && cred.ClientSecret == "" {
+			cred.ClientSecret = config.OAuth.ClientSecret
+		}
+		result = *cred
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if config.AccessToken != "" || config.RefreshToken != "" || config.ExpiresAt != nil || moveSecret {
+		config.AccessToken = ""
+		config.RefreshToken = ""
+		config.ExpiresAt = nil
+		if moveSecret {
+			config.OAuth.ClientSecret = ""
+		}
+		if err := writeConfigFile(data); err != nil {
+			return nil, fmt.Errorf("从配置文件中移除token失败: %v", err)
+		}
+	}
+	return &result, nil
+}
+
+// 保存token到当前profile的凭据存储
+func saveToken(tokenResp *TokenResponse) error {
+	_, err := updateStoredToken(func(*Credentials) (*TokenResponse, error) {
+		return tokenResp, nil
+	})
+	return err
+}
+
+// 使用授权接口返回的token更新凭据，过期时间从现在开始计算
+func (c *Credentials) setToken(tokenResp *TokenResponse) {
+	c.AccessToken = tokenResp.AccessToken
+	if tokenResp.RefreshToken != "" {
+		c.RefreshToken = tokenResp.RefreshToken
+	}
+	c.ExpiresAt = nil
+	if tokenResp.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+		c.ExpiresAt = &expiresAt
+	}
+}
+
+// 凭据文件，权限为0600，修改时持有 <文件>.lock 锁，避免多个进程同时刷新token时互相覆盖
+type fileCredentialStore struct {
+	path string
+}
+
+// 读取凭据文件，不存在时返回空的内容；已加密时使用 BDDISK_PASSPHRASE 解密
+func (s *fileCredentialStore) read() (*credentialsFileData, error) {
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &credentialsFileData{Version: credentialsVersion, Profiles: make(map[string]*Credentials)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data credentialsFileData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("解析凭据文件 %s 失败: %v", s.path, err)
+	}
+	if data.Version > credentialsVersion {
+		return nil, fmt.Errorf("凭据文件 %s 的版本 %d 高于当前程序支持的版本，请升级", s.path, data.Version)
+	}
+	if data.Encryption != nil {
+		if err := data.decrypt(); err != nil {
+			return nil, fmt.Errorf("解密凭据文件 %s 失败: %v", s.path, err)
+		}
+	}
+	if data.Profiles == nil {
+		data.Profiles = make(map[string]*Credentials)
+	}
+	return &data, nil
+}
+
+// 原子写入凭据文件，已加密的文件使用新的nonce重新加密
+func (s *fileCredentialStore) write(data *credentialsFileData) error {
+	data.Version = credentialsVersion
+	out := *data
+	if data.Encryption != nil {
+		if err := out.encrypt(); err != nil {
+			return fmt.Errorf("加密凭据失败: %v", err)
+		}
+	}
+	raw, err := json.MarshalIndent(&out, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化凭据失败: %v", err)
+	}
+	return writeFileAtomic(s.path, raw, 0600)
+}
+
+func (s *fileCredentialStore) get(profile string) (*Credentials, error) {
+	data, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return data.Profiles[profile], nil
+}
+
+// 持有锁读取、修改并保存凭据文件
+func (s *fileCredentialStore) modify(fn func(data *credentialsFileData) error) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建凭据目录失败: %v", err)
+	}
+	unlock, err := lockFile(s.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	if err := fn(data); err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+func (s *fileCredentialStore) update(profile string, fn func(cred *Credentials) error) error {
+	return s.modify(func(data *credentialsFileData) error {
+		cred := data.Profiles[profile]
+		if cred == nil {
+			cred = &Credentials{}
+		}
+		if err := fn(cred); err != nil {
+			return err
+		}
+		data.Profiles[profile] = cred
+		return nil
+	})
+}
+
+func (s *fileCredentialStore) erase(profile string) error {
+	if _, err := os.Stat(s.path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return s.modify(func(data *credentialsFileData) error {
+		delete(data.Profiles, profile)
+		return nil
+	})
+}
+
+// 加密时使用的口令
+func credentialsPassphrase() (string, error) {
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		return "", fmt.Errorf("凭据文件需要口令，请通过环境变量 %s 提供", passphraseEnv)
+	}
+	return passphrase, nil
+}
+
+// 同一进程中按口令和salt缓存派生的密钥，每次保存token时无需重新计算PBKDF2
+var (
+	derivedKeysMu sync.Mutex
+	derivedKeys   = make(map[string][]byte)
+)
+
+func credentialsKey(passphrase string, salt []byte, iterations int) []byte {
+	derivedKeysMu.Lock()
+	defer derivedKeysMu.Unlock()
+	cacheKey := fmt.Sprintf("%x:%x:%d", sha256.Sum256([]byte(passphrase)), salt, iterations)
+	if key, ok := derivedKeys[cacheKey]; ok {
+		return key
+	}
+	key := pbkdf2SHA256([]byte(passphrase), salt, iterations, 32)
+	derivedKeys[cacheKey] = key
+	return key
+}
+
+// 加密profiles，首次加密时生成salt；每次加密使用新的nonce
+func (d *credentialsFileData) encrypt() error {
+	passphrase, err := credentialsPassphrase()
+	if err != nil {
+		return err
+	}
+	enc := *d.Encryption
+	if enc.Salt == "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		enc = credentialsEncryption{KDF: "pbkdf2-sha256", Iterations: credentialsIterations, Salt: base64.StdEncoding.EncodeToString(salt), Cipher: "aes-256-gcm"}
+		*d.Encryption = enc
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return fmt.Errorf("salt无效: %v", err)
+	}
+	aead, err := newCredentialsAEAD(credentialsKey(passphrase, salt, enc.Iterations))
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(d.Profiles)
+	if err != nil {
+		return err
+	}
+	enc.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	d.Encryption = &enc
+	d.Data = base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, plaintext, nil))
+	d.Profiles = nil
+	return nil
+}
+
+// 解密data中的profiles
+func (d *credentialsFileData) decrypt() error {
+	enc := d.Encryption
+	if enc.KDF != "pbkdf2-sha256" || enc.Cipher != "aes-256-gcm" || enc.Iterations <= 0 {
+		return fmt.Errorf("不支持的加密方式: %s/%s", enc.KDF, enc.Cipher)
+	}
+	passphrase, err := credentialsPassphrase()
+	if err != nil {
+		return err
+	}
+	salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+	if err != nil {
+		return fmt.Errorf("salt无效: %v", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(enc.Nonce)
+	if err != nil {
+		return fmt.Errorf("nonce无效: %v", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(d.Data)
+	if err != nil {
+		return fmt.Errorf("密文无效: %v", err)
+	}
+	aead, err := newCredentialsAEAD(credentialsKey(passphrase, salt, enc.Iterations))
+	if err != nil {
+		return err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return fmt.Errorf("nonce长度错误")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return fmt.Errorf("口令错误或文件已损坏")
+	}
+	if err := json.Unmarshal(plaintext, &d.Profiles); err != nil {
+		return err
+	}
+	d.Data = ""
+	return nil
+}
+
+func newCredentialsAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// PBKDF2-HMAC-SHA256（RFC 8018）
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	key := make([]byte, 0, blocks*hashLen)
+	var counter [4]byte
+	u := make([]byte, hashLen)
+	t := make([]byte, hashLen)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// git风格的外部凭据程序：以 "<程序> get|store|erase" 调用，
+// 通过标准输入输出交换 key=value 行（profile、access_token、refresh_token、expires_at、client_secret、serve_token），空行结束。
+// 以 ! 开头时作为shell命令执行，包含路径分隔符时直接执行该程序，否则执行 bddisk-credential-<名称>
+type helperCredentialStore struct {
+	helper string
+}
+
+func (s *helperCredentialStore) command(action string) *exec.Cmd {
+	var line string
+	switch {
+	case strings.HasPrefix(s.helper, "!"):
+		line = strings.TrimPrefix(s.helper, "!")
+	case strings.ContainsAny(s.helper, `/\`):
+		line = s.helper
+	default:
+		line = "bddisk-credential-" + s.helper
+	}
+	line += " " + action
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("sh", "-c", line)
+}
+
+func (s *helperCredentialStore) run(action string, fields map[string]string) (map[string]string, error) {
+	var input bytes.Buffer
+	for _, key := range []string{"profile", "access_token", "refresh_token", "expires_at", "client_secret", "serve_token"} {
+		if value := fields[key]; value != "" {
+			fmt.Fprintf(&input, "%s=%s\n", key, value)
+		}
+	}
+	input.WriteString("\n")
+
+	cmd := s.command(action)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("凭据程序 %s %s 执行失败: %v", s.helper, action, err)
+	}
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+func (s *helperCredentialStore) get(profile string) (*Credentials, error) {
+	fields, err := s.run("get", map[string]string{"profile": profile})
+	if err != nil {
+		return nil, err
+	}
+	cred := &Credentials{
+		AccessToken:  fields["access_token"],
+		RefreshToken: fields["refresh_token"],
+		ClientSecret: fields["client_secret"],
+		ServeToken:   fields["serve_token"],
+	}
+	if v := fields["expires_at"]; v != "" {
+		expiresAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("凭据程序返回的expires_at无效: %v", err)
+		}
+		cred.ExpiresAt = &expiresAt
+	}
+	if *cred == (Credentials{}) {
+		return nil, nil
+	}
+	return cred, nil
+}
+
+func (s *helperCredentialStore) update(profile string, fn func(cred *Credentials) error) error {
+	cred, err := s.get(profile)
+	if err != nil {
+		return err
+	}
+	if cred == nil {
+		cred = &Credentials{}
+	}
+	if err := fn(cred); err != nil {
+		return err
+	}
+	fields := map[string]string{
+		"profile":       profile,
+		"access_token":  cred.AccessToken,
+		"refresh_token": cred.RefreshToken,
+		"client_secret": cred.ClientSecret,
+		"serve_token":   cred.ServeToken,
+	}
+	if cred.ExpiresAt != nil {
+		fields["expires_at"] = cred.ExpiresAt.Format(time.RFC3339)
+	}
+	_, err = s.run("store", fields)
+	return err
+}
+
+func (s *helperCredentialStore) erase(profile string) error {
+	_, err := s.run("erase", map[string]string{"profile": profile})
+	return err
+}
+
+// credentials status|migrate|encrypt|decrypt
+func runCredentials(args []string) int {
+	if err := logger.InitWithConsole(logger.INFO, os.Stderr, "", false); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	usage := fmt.Errorf("用法: ./bddisk_uploader credentials status|migrate|encrypt|decrypt [-config 路径] [-profile 名称]")
+	if len(args) == 0 {
+		return commandFailed(context.Background(), usage)
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("credentials "+action, flag.ExitOnError)
+	addConfigFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	data, err := readConfigFile()
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	profile := currentProfile()
+	config, err := data.profile(profile)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	store, isFile := credentialStoreFor(config).(*fileCredentialStore)
+
+	switch action {
+	case "status":
+		if !isFile {
+			fmt.Printf("凭据程序: %s\n", config.CredentialHelper)
+		} else {
+			printCredentialsFileStatus(store)
+		}
+		if config.AccessToken != "" && config.AccessToken != "your_access_token_here" || config.OAuth != nil && realClientSecret(config.OAuth.ClientSecret) {
+			fmt.Printf("配置文件 %s 中仍有旧版本保存的token或client_secret，运行 credentials migrate%s 移到凭据存储\n", configFilePath(), profileFlagHint())
+		}
+		return 0
+
+	case "migrate":
+		if _, err := updateStoredToken(func(*Credentials) (*TokenResponse, error) { return nil, nil }); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		logger.Info("profile %s 的token和client_secret已保存到凭据存储", profile)
+		return 0
+
+	case "encrypt", "decrypt":
+		if !isFile {
+			return commandFailed(context.Background(), fmt.Errorf("使用凭据程序时由凭据程序负责加密"))
+		}
+		encrypt := action == "encrypt"
+		err := store.modify(func(data *credentialsFileData) error {
+			if encrypt && data.Encryption != nil {
+				return fmt.Errorf("凭据文件已经加密")
+			}
+			if !encrypt && data.Encryption == nil {
+				return fmt.Errorf("凭据文件没有加密")
+			}
+			data.Encryption = nil
+			if encrypt {
+				data.Encryption = &credentialsEncryption{}
+			}
+			return nil
+		})
+		if err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		if encrypt {
+			logger.Info("凭据文件已加密，之后运行时需要通过环境变量 %s 提供口令", passphraseEnv)
+		} else {
+			logger.Info("凭据文件已解密")
+		}
+		return 0
+	}
+	return commandFailed(context.Background(), usage)
+}
+
+// 输出凭据文件的路径、权限、是否加密和保存了凭据的profile
+func printCredentialsFileStatus(store *fileCredentialStore) {
+	fmt.Printf("凭据文件: %s\n", store.path)
+	info, err := os.Stat(store.path)
+	if err != nil {
+		fmt.Println("状态: 不存在（授权或刷新token后创建）")
+		return
+	}
+	fmt.Printf("权限: %04o\n", info.Mode().Perm())
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		fmt.Printf("警告: 其他用户可以读取凭据文件，请运行: chmod 600 %s\n", store.path)
+	}
+
+	raw, err := os.ReadFile(store.path)
+	var header credentialsFileData
+	if err == nil {
+		err = json.Unmarshal(raw, &header)
+	}
+	if err != nil {
+		fmt.Printf("状态: 无法读取（%v）\n", err)
+		return
+	}
+	if header.Encryption != nil {
+		fmt.Printf("加密: %s，%s（%d次迭代）\n", header.Encryption.Cipher, header.Encryption.KDF, header.Encryption.Iterations)
+	} else {
+		fmt.Println("加密: 否")
+	}
+	data, err := store.read()
+	if err != nil {
+		fmt.Printf("状态: 无法读取（%v）\n", err)
+		return
+	}
+	names := make([]string, 0, len(data.Profiles))
+	for name := range data.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("已保存的profile: %s\n", strings.Join(names, ", "))
+}
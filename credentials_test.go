@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	for _, tc := range []struct {
+		iterations int
+		want       string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	} {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte("password"), []byte("salt"), tc.iterations, 32))
+		if got != tc.want {
+			t.Errorf("pbkdf2SHA256(%d) = %s, want %s", tc.iterations, got, tc.want)
+		}
+	}
+}
+
+func TestCredentialsEncryptRoundTrip(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse")
+	store := &fileCredentialStore{path: filepath.Join(t.TempDir(), "credentials.json")}
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	cred := &Credentials{AccessToken: "access-123", RefreshToken: "refresh-456", ExpiresAt: &expiresAt, ClientSecret: "secret-789"}
+	data := &credentialsFileData{Encryption: &credentialsEncryption{}, Profiles: map[string]*Credentials{"work": cred}}
+	if err := store.write(data); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"access-123", "refresh-456", "secret-789"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("encrypted credentials file contains %s", secret)
+		}
+	}
+
+	got, err := store.get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.AccessToken != cred.AccessToken || got.RefreshToken != cred.RefreshToken ||
+		got.ClientSecret != cred.ClientSecret || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("decrypted credentials = %+v, want %+v", got, cred)
+	}
+
+	// 修改后重新加密，仍然可以解密
+	if err := store.update("work", func(c *Credentials) error {
+		c.AccessToken = "access-new"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.get("work"); err != nil || got.AccessToken != "access-new" || got.RefreshToken != "refresh-456" {
+		t.Errorf("after update: %+v, %v", got, err)
+	}
+
+	t.Setenv(passphraseEnv, "wrong")
+	if _, err := store.get("work"); err == nil {
+		t.Error("decrypting with a wrong passphrase should fail")
+	}
+	t.Setenv(passphraseEnv, "")
+	if _, err := store.get("work"); err == nil {
+		t.Error("decrypting without a passphrase should fail")
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bddisk_uploader/logger"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+const (
+	doctorMinFreeSpace = 100 * 1024 * 1024 // 缓存目录剩余空间低于该值时警告
+	doctorSlowLatency  = 2 * time.Second   // 连接服务地址超过该时间时警告
+)
+
+// 检查结果
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+	doctorSkip = "skip"
+)
+
+var doctorStatusText = map[string]string{
+	doctorOK:   "通过",
+	doctorWarn: "警告",
+	doctorFail: "失败",
+	doctorSkip: "跳过",
+}
+
+// doctor 的一项检查，用于--json输出
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// doctor：依次检查配置、token、缓存目录、授权回调端口和服务地址的连通性，有失败项时返回1。
+// 只使用当前的access_token，不会刷新或保存token
+func runDoctor(args []string) int {
+	if err := logger.InitWithConsole(logger.INFO, os.Stderr, "", false); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	addConfigFlags(fs)
+	cacheDir := fs.String("cache-dir", "", "缓存目录路径（默认为当前目录下的.chunks）")
+	port := fs.Int("port", 8080, "授权回调服务器端口")
+	timeout := fs.Duration("timeout", 10*time.Second, "每个网络检查的超时时间")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	if err := fs.Parse(args); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+
+	var checks []DoctorCheck
+	add := func(name, status, detail, hint string) {
+		checks = append(checks, DoctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+	}
+
+	config, err := loadProfileConfig()
+	if err != nil {
+		add("配置文件", doctorFail, err.Error(), "运行 ./bddisk_uploader -init 创建配置文件，或用 -config 指定配置文件")
+		config = &Config{}
+	} else {
+		detail := fmt.Sprintf("%s（profile %s）", configFilePath(), currentProfile())
+		if problems := configProblems(config, false, false); len(problems) > 0 {
+			add("配置文件", doctorFail, detail+": "+strings.Join(problems, "；"), "使用 ./bddisk_uploader config set <配置项> <值>"+profileFlagHint()+" 修改")
+		} else {
+			add("配置文件", doctorOK, detail, "")
+		}
+		oauthHint := "授权和自动刷新token需要开放平台应用的App Key和Secret Key，使用 config set oauth.client_id|oauth.client_secret 设置"
+		switch {
+		case config.OAuth == nil || config.OAuth.ClientID == "" || config.OAuth.ClientID == "your_app_key_here":
+			add("OAuth应用", doctorWarn, "未设置client_id", oauthHint)
+		case !realClientSecret(config.OAuth.ClientSecret):
+			add("OAuth应用", doctorWarn, "未设置client_secret", oauthHint)
+		default:
+			add("OAuth应用", doctorOK, "client_id "+config.OAuth.ClientID, "")
+		}
+	}
+	initSDKClients(config)
+
+	tokenUsable := doctorCheckExpiry(config, add)
+	if tokenUsable {
+		doctorCheckUserInfo(config, *timeout, add)
+	} else {
+		add("token验证", doctorSkip, "没有可用的access_token", "")
+	}
+	doctorCheckCacheDir(*cacheDir, add)
+	doctorCheckAuthPort(config, *port, !tokenUsable, add)
+
+	client := utils.NewClient(sdkOptions(config)...)
+	doctorCheckLatency("API服务", client.APIBaseURL, client.APIHTTPClient, *timeout, add)
+	doctorCheckLatency("上传服务", client.UploadBaseURL, client.UploadHTTPClient, *timeout, add)
+
+	failed := false
+	for _, check := range checks {
+		failed = failed || check.Status == doctorFail
+	}
+	if *jsonOutput {
+		if err := printJSON(checks); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+	} else {
+		printDoctorChecks(checks)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// 检查access_token的有效期，返回是否有可以尝试使用的token
+func doctorCheckExpiry(config *Config, add func(name, status, detail, hint string)) bool {
+	const name = "token有效期"
+	authHint := "运行 ./bddisk_uploader -auth" + profileFlagHint() + " 授权"
+	if config.AccessToken == "" || config.AccessToken == "your_access_token_here" {
+		add(name, doctorFail, "尚未授权", authHint)
+		return false
+	}
+	if config.ExpiresAt == nil {
+		add(name, doctorOK, "过期时间未知", "")
+		return true
+	}
+	expiresAt := config.ExpiresAt.Local().Format("2006-01-02 15:04")
+	remaining := time.Until(*config.ExpiresAt)
+	canRefresh := doctorCanRefresh(config)
+	switch {
+	case remaining <= 0 && !canRefresh:
+		add(name, doctorFail, "已于 "+expiresAt+" 过期，且无法自动刷新", authHint)
+		return false
+	case remaining <= 0:
+		add(name, doctorWarn, "已于 "+expiresAt+" 过期，下次调用接口时自动刷新", "")
+	case remaining <= TokenRefreshAhead:
+		add(name, doctorWarn, "将于 "+expiresAt+" 过期，下次调用接口时自动刷新", "")
+	default:
+		add(name, doctorOK, fmt.Sprintf("有效期至 %s（剩余%.0f天）", expiresAt, remaining.Hours()/24), "")
+	}
+	return true
+}
+
+// 是否可以用refresh_token自动刷新access_token
+func doctorCanRefresh(config *Config) bool {
+	return config.RefreshToken != "" && config.OAuth != nil && realClientSecret(config.OAuth.ClientSecret)
+}
+
+// 使用当前的access_token调用用户信息接口，token无效时不刷新，只提示下次调用接口时会自动刷新
+func doctorCheckUserInfo(config *Config, timeout time.Duration, add func(name, status, detail, hint string)) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	info, err := userClient.InfoWithContext(ctx, config.AccessToken)
+	if isTokenError(err) && doctorCanRefresh(config) {
+		add("token验证", doctorWarn, "当前access_token无效，下次调用接口时会使用refresh_token自动刷新（doctor不刷新token）",
+			"运行 ./bddisk_uploader -refresh-token"+profileFlagHint()+" 立即刷新")
+		return
+	}
+	if err != nil {
+		hint := errorHint(err)
+		if hint == "" {
+			hint = "检查网络连接和api_host设置"
+		}
+		// 网络错误中的请求地址包含access_token，只输出原因
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		add("token验证", doctorFail, "获取用户信息失败: "+err.Error(), hint)
+		return
+	}
+	add("token验证", doctorOK, fmt.Sprintf("账号 %s（%s）", info.NetdiskName, limitsForVipType(info.VipType).Name), "")
+}
+
+// 检查缓存目录是否可写以及剩余空间
+func doctorCheckCacheDir(customCacheDir string, add func(name, status, detail, hint string)) {
+	const name = "缓存目录"
+	dir, err := getCacheDir(customCacheDir)
+	if err != nil {
+		add(name, doctorFail, err.Error(), "使用 -cache-dir 指定可写的目录")
+		return
+	}
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err == nil {
+		_, err = f.WriteString("ok")
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		os.Remove(f.Name())
+	}
+	if err != nil {
+		add(name, doctorFail, fmt.Sprintf("%s 不可写: %v", dir, err), "检查目录权限，或使用 -cache-dir 指定可写的目录")
+		return
+	}
+	free, err := diskFree(dir)
+	switch {
+	case err != nil:
+		add(name, doctorWarn, fmt.Sprintf("%s 可写，无法获取剩余空间: %v", dir, err), "")
+	case free < doctorMinFreeSpace:
+		add(name, doctorWarn, fmt.Sprintf("%s 剩余空间只有 %s", dir, formatFileSize(int64(free))), "清理磁盘，或使用 -cache-dir 指定其他磁盘上的目录")
+	default:
+		add(name, doctorOK, fmt.Sprintf("%s 可写，剩余 %s", dir, formatFileSize(int64(free))), "")
+	}
+}
+
+// 检查授权回调服务器的端口是否空闲，以及是否与redirect_uri一致；
+// 端口被占用只影响重新授权，needAuth为true（没有可用的token）时才视为失败
+func doctorCheckAuthPort(config *Config, port int, needAuth bool, add func(name, status, detail, hint string)) {
+	const name = "授权回调端口"
+	redirectURI := DefaultRedirectURI
+	if config.OAuth != nil && config.OAuth.RedirectURI != "" {
+		redirectURI = config.OAuth.RedirectURI
+	}
+	if redirectURI == "oob" {
+		add(name, doctorSkip, "redirect_uri为oob，授权时手动输入授权码", "")
+		return
+	}
+
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		status := doctorWarn
+		if needAuth {
+			status = doctorFail
+		}
+		add(name, status, fmt.Sprintf("端口 %d 已被占用: %v", port, err),
+			"关闭占用端口的程序，或授权时使用 -port 指定其他端口并同步修改redirect_uri，也可以使用 -paste 或 -device 授权")
+		return
+	}
+	listener.Close()
+
+	if u, err := url.Parse(redirectURI); err == nil {
+		if p := u.Port(); p != "" && p != strconv.Itoa(port) {
+			add(name, doctorWarn, fmt.Sprintf("端口 %d 空闲，但redirect_uri %s 使用端口 %s", port, redirectURI, p),
+				"授权时使用 -port "+p+"，或修改redirect_uri")
+			return
+		}
+	}
+	add(name, doctorOK, fmt.Sprintf("端口 %d 空闲", port), "")
+}
+
+// 测量连接服务地址并收到响应所需的时间，任何HTTP响应都视为可以连通
+func doctorCheckLatency(name, baseURL string, client *http.Client, timeout time.Duration, add func(name, status, detail, hint string)) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL, nil)
+	if err != nil {
+		add(name, doctorFail, err.Error(), "检查配置项api_host和upload_host")
+		return
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	elapsed := time.Since(start)
+	latency := fmt.Sprintf("%.1fms", elapsed.Seconds()*1000)
+	if err != nil {
+		add(name, doctorFail, fmt.Sprintf("无法连接 %s: %v", baseURL, err), "检查网络连接、代理设置（HTTPS_PROXY）和配置项api_host、upload_host")
+		return
+	}
+	resp.Body.Close()
+	if elapsed > doctorSlowLatency {
+		add(name, doctorWarn, fmt.Sprintf("%s 延迟 %s", baseURL, latency), "网络较慢，上传时可以减小 -concurrent 避免超时")
+		return
+	}
+	add(name, doctorOK, fmt.Sprintf("%s 延迟 %s", baseURL, latency), "")
+}
+
+// 以表格输出检查结果，失败和警告项附带处理建议
+func printDoctorChecks(checks []DoctorCheck) {
+	nameWidth := 0
+	for _, check := range checks {
+		if w := displayWidth(check.Name); w > nameWidth {
+			nameWidth = w
+		}
+	}
+	for _, check := range checks {
+		padding := strings.Repeat(" ", nameWidth-displayWidth(check.Name))
+		fmt.Printf("[%s] %s%s  %s\n", doctorStatusText[check.Status], check.Name, padding, check.Detail)
+		if check.Hint != "" && check.Status != doctorOK {
+			fmt.Printf("       %s  提示: %s\n", strings.Repeat(" ", nameWidth), check.Hint)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, check := range checks {
+		counts[check.Status]++
+	}
+	fmt.Printf("\n%d项通过，%d项警告，%d项失败\n", counts[doctorOK], counts[doctorWarn], counts[doctorFail])
+}
+
+// 字符串在终端中的显示宽度，中文等宽字符按2计算
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x1100 {
+			width += 2
+		} else {
+			width++
+		}
+	}
+	return width
+}
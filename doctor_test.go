@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 收集doctor的检查结果
+func collectDoctorChecks() (*[]DoctorCheck, func(name, status, detail, hint string)) {
+	var checks []DoctorCheck
+	return &checks, func(name, status, detail, hint string) {
+		checks = append(checks, DoctorCheck{Name: name, Status: status, Detail: detail, Hint: hint})
+	}
+}
+
+func TestDoctorCheckAuthPortInUse(t *testing.T) {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+	config := &Config{OAuth: &OAuthConfig{RedirectURI: "http://localhost:8080/callback"}}
+
+	// 有可用的token时端口被占用只是警告
+	checks, add := collectDoctorChecks()
+	doctorCheckAuthPort(config, port, false, add)
+	if len(*checks) != 1 || (*checks)[0].Status != doctorWarn {
+		t.Errorf("checks with a usable token = %+v, want warn", *checks)
+	}
+
+	checks, add = collectDoctorChecks()
+	doctorCheckAuthPort(config, port, true, add)
+	if len(*checks) != 1 || (*checks)[0].Status != doctorFail {
+		t.Errorf("checks without a usable token = %+v, want fail", *checks)
+	}
+}
+
+func TestDoctorCheckUserInfoDoesNotRefresh(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		io.WriteString(w, `{"errno":-6,"request_id":1}`)
+	}))
+	defer server.Close()
+
+	expiresAt := time.Now().Add(time.Hour)
+	config := &Config{
+		AccessToken:  "stale",
+		RefreshToken: "refresh",
+		ExpiresAt:    &expiresAt,
+		APIHost:      server.URL,
+		OAuth:        &OAuthConfig{ClientID: "id", ClientSecret: "secret"},
+	}
+	initSDKClients(config)
+	defer initSDKClients(&Config{})
+
+	checks, add := collectDoctorChecks()
+	doctorCheckUserInfo(config, 5*time.Second, add)
+	if len(*checks) != 1 || (*checks)[0].Status != doctorWarn {
+		t.Errorf("checks = %+v, want warn", *checks)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("user info called %d times, want 1", n)
+	}
+	if tokens.accessToken != "stale" {
+		t.Errorf("token source changed to %q", tokens.accessToken)
+	}
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bddisk_uploader/logger"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/download"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+const (
+	DownloadPartSuffix   = ".part"      // 未下载完成的文件后缀
+	DownloadStateSuffix  = ".part.json" // 下载进度文件后缀
+	MinDownloadRange     = 4 * 1024 * 1024
+	downloadBufferSize   = 256 * 1024
+	downloadSaveEvery    = 4 * 1024 * 1024  // 每下载这么多数据保存一次进度
+	downloadStallTimeout = 60 * time.Second // 超过这么长时间没有收到数据时中止连接并重试
+)
+
+// 下载接口使用的SDK客户端，加载配置后重新创建
+var downloadClient = download.NewClient()
+
+// 下载选项
+type DownloadOptions struct {
+	Connections    int  // 单个文件同时使用的Range连接数
+	MaxConcurrent  int  // 同时下载的文件数
+	Verify         bool // 下载完成后校验MD5，本地已有的文件只比较大小
+	DeleteMismatch bool // MD5校验失败时删除下载的数据，默认保留
+}
+
+// 一个Range连接负责的区间 [Start, End)，Done 为已写入的字节数
+type downloadRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+func (r *downloadRange) remaining() int64 {
+	return r.End - r.Start - r.Done
+}
+
+// 下载进度，保存在 <本地文件>.part.json 中，用于断点续传
+type downloadState struct {
+	FsId   uint64           `json:"fs_id"`
+	Path   string           `json:"path"`
+	Size   int64            `json:"size"`
+	Md5    string           `json:"md5"`
+	Ranges []*downloadRange `json:"ranges"`
+
+	path    string
+	mu      sync.Mutex
+	unsaved int64
+}
+
+// 按连接数切分区间，每个区间不小于 MinDownloadRange
+func newDownloadState(statePath string, meta file.FileMeta, connections int) *downloadState {
+	size := int64(meta.Size)
+	n := int((size + MinDownloadRange - 1) / MinDownloadRange)
+	if n > connections {
+		n = connections
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	state := &downloadState{FsId: meta.FsId, Path: meta.Path, Size: size, Md5: meta.Md5, path: statePath}
+	rangeSize := size / int64(n)
+	for i := 0; i < n; i++ {
+		r := &downloadRange{Start: int64(i) * rangeSize, End: int64(i+1) * rangeSize}
+		if i == n-1 {
+			r.End = size
+		}
+		state.Ranges = append(state.Ranges, r)
+	}
+	return state
+}
+
+// 加载与远程文件匹配的下载进度，远程文件已变化或 .part 文件不完整时返回nil
+func loadDownloadState(statePath, partPath string, meta file.FileMeta) *downloadState {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil
+	}
+	var state downloadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		logger.Warn("下载进度文件损坏，重新下载: %v", err)
+		return nil
+	}
+	if state.FsId != meta.FsId || state.Size != int64(meta.Size) || state.Md5 != meta.Md5 || len(state.Ranges) == 0 {
+		logger.Info("远程文件已变化，重新下载: %s", meta.Path)
+		return nil
+	}
+	if info, err := os.Stat(partPath); err != nil || info.Size() != state.Size {
+		return nil
+	}
+	state.path = statePath
+	return &state
+}
+
+func (s *downloadState) downloaded() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var done int64
+	for _, r := range s.Ranges {
+		done += r.Done
+	}
+	return done
+}
+
+// 记录区间进度，累计到一定量时保存到磁盘
+func (s *downloadState) advance(r *downloadRange, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.Done += n
+	s.unsaved += n
+	if s.unsaved >= downloadSaveEvery {
+		if err := s.saveLocked(); err != nil {
+			logger.Warn("保存下载进度失败: %v", err)
+		}
+	}
+}
+
+func (s *downloadState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveLocked()
+}
+
+func (s *downloadState) saveLocked() error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	s.unsaved = 0
+	return writeFileAtomic(s.path, data, 0644)
+}
+
+// 获取文件的下载地址和元信息
+func fetchDownloadMeta(ctx context.Context, fsId uint64) (file.FileMeta, error) {
+	var ret file.FileMetasReturn
+	err := withToken(func(accessToken string) (err error) {
+		ret, err = fileClient.FileMetasWithContext(ctx, accessToken, file.NewFileMetasArg([]uint64{fsId}, true))
+		return err
+	})
+	if err != nil {
+		return file.FileMeta{}, fmt.Errorf("获取下载地址失败: %w", err)
+	}
+	if len(ret.List) == 0 || ret.List[0].Dlink == "" {
+		return file.FileMeta{}, fmt.Errorf("获取下载地址失败: 服务端未返回dlink")
+	}
+	return ret.List[0], nil
+}
+
+// 下载一个区间中尚未完成的部分。
+// 超过stallTimeout没有收到数据时中止连接并返回 *utils.StallError，重试时从已写入的位置继续
+func fetchRange(ctx context.Context, dlink string, f *os.File, r *downloadRange, state *downloadState, stallTimeout time.Duration) (err error) {
+	remaining := r.remaining()
+	if remaining <= 0 {
+		return nil
+	}
+	offset := r.Start + r.Done
+
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var stalled int32
+	timer := time.AfterFunc(stallTimeout, func() {
+		atomic.StoreInt32(&stalled, 1)
+		cancel()
+	})
+	defer func() {
+		timer.Stop()
+		if err != nil && atomic.LoadInt32(&stalled) == 1 && ctx.Err() == nil {
+			err = &utils.StallError{Idle: stallTimeout}
+		}
+	}()
+
+	var ret download.DownloadReturn
+	err = withToken(func(accessToken string) (err error) {
+		ret, err = downloadClient.DownloadWithContext(attemptCtx, accessToken, download.NewDownloadArg(dlink, offset, remaining))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer ret.Body.Close()
+	if !ret.Partial && (offset > 0 || remaining != state.Size) {
+		return fmt.Errorf("服务端不支持Range请求")
+	}
+
+	buf := make([]byte, downloadBufferSize)
+	for remaining > 0 {
+		n, err := ret.Body.Read(buf)
+		timer.Reset(stallTimeout)
+		if int64(n) > remaining {
+			n = int(remaining)
+		}
+		if n > 0 {
+			if _, werr := f.WriteAt(buf[:n], offset); werr != nil {
+				return fmt.Errorf("写入文件失败: %v", werr)
+			}
+			offset += int64(n)
+			remaining -= int64(n)
+			state.advance(r, int64(n))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if remaining > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// 下载区间，失败时从已写入的位置继续重试
+func fetchRangeWithRetry(ctx context.Context, dlink string, f *os.File, r *downloadRange, state *downloadState) error {
+	var lastErr error
+
+	for attempt := 0; attempt <= MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := time.Duration(math.Pow(2, float64(attempt-1))) * BaseRetryDelay
+			logger.Warn("%s 区间 %d-%d 第 %d 次重试，等待 %v...", state.Path, r.Start, r.End, attempt, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		before := r.Done
+		err := fetchRange(ctx, dlink, f, r, state, downloadStallTimeout)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !isRetryableError(err) {
+			return err
+		}
+		lastErr = err
+		// 有进展的中断不计入重试次数
+		if r.Done > before {
+			attempt = 0
+		}
+		logger.Warn("%s 区间 %d-%d 下载中断: %v", state.Path, r.Start, r.End, err)
+	}
+
+	return fmt.Errorf("下载失败，已尝试 %d 次: %w", MaxRetries+1, lastErr)
+}
+
+func fileMD5(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// 本地文件与远程文件大小相同时无需下载。
+// 部分文件的filemetas md5并不是文件内容的MD5，不能用来判断已下载的文件，否则每次都会重新下载
+func localFileMatches(localPath string, meta file.FileMeta) bool {
+	info, err := os.Stat(localPath)
+	return err == nil && !info.IsDir() && info.Size() == int64(meta.Size)
+}
+
+// 下载单个远程文件到localPath，返回本次下载的字节数；本地已有相同文件时skipped为true
+func downloadRemoteFile(ctx context.Context, fsId uint64, localPath string, opts *DownloadOptions) (downloaded int64, skipped bool, err error) {
+	meta, err := fetchDownloadMeta(ctx, fsId)
+	if err != nil {
+		return 0, false, err
+	}
+	if localFileMatches(localPath, meta) {
+		return 0, true, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return 0, false, fmt.Errorf("创建目录失败: %v", err)
+	}
+
+	partPath := localPath + DownloadPartSuffix
+	statePath := localPath + DownloadStateSuffix
+	state := loadDownloadState(statePath, partPath, meta)
+	if state != nil {
+		logger.Info("继续下载 %s (已完成 %s/%s)", meta.Path, formatFileSize(state.downloaded()), formatFileSize(state.Size))
+	} else {
+		state = newDownloadState(statePath, meta, opts.Connections)
+	}
+	before := state.downloaded()
+
+	f, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, false, fmt.Errorf("创建文件失败: %v", err)
+	}
+	if err := f.Truncate(state.Size); err != nil {
+		f.Close()
+		return 0, false, fmt.Errorf("创建文件失败: %v", err)
+	}
+	if err := state.save(); err != nil {
+		f.Close()
+		return 0, false, fmt.Errorf("保存下载进度失败: %v", err)
+	}
+
+	// 任一区间失败时取消其余区间
+	rangeCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for _, r := range state.Ranges {
+		if r.remaining() <= 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(r *downloadRange) {
+			defer wg.Done()
+			if err := fetchRangeWithRetry(rangeCtx, meta.Dlink, f, r, state); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(r)
+	}
+	wg.Wait()
+	cancel()
+
+	downloaded = state.downloaded() - before
+	if err := state.save(); err != nil {
+		logger.Warn("保存下载进度失败: %v", err)
+	}
+	if firstErr == nil {
+		firstErr = f.Sync()
+	}
+	if cerr := f.Close(); firstErr == nil {
+		firstErr = cerr
+	}
+	if firstErr != nil {
+		if ctx.Err() != nil {
+			return downloaded, false, ctx.Err()
+		}
+		return downloaded, false, firstErr
+	}
+
+	if opts.Verify && meta.Md5 != "" {
+		sum, err := fileMD5(partPath)
+		if err != nil {
+			return downloaded, false, fmt.Errorf("校验文件失败: %v", err)
+		}
+		if !strings.EqualFold(sum, meta.Md5) {
+			// 部分文件的filemetas md5并不是文件内容的MD5，默认保留下载的数据，
+			// 确认内容正确时使用 -no-verify 重新运行即可直接完成，无需重新下载
+			if opts.DeleteMismatch {
+				os.Remove(partPath)
+				os.Remove(statePath)
+				return downloaded, false, fmt.Errorf("MD5校验失败: 本地 %s，远程 %s，已删除下载的数据", sum, meta.Md5)
+			}
+			return downloaded, false, fmt.Errorf("MD5校验失败: 本地 %s，远程 %s，下载的数据保留在 %s（确认内容正确时可使用 -no-verify 重新运行完成下载，或使用 -delete-mismatch 删除后重新下载）", sum, meta.Md5, partPath)
+		}
+	}
+
+	if err := os.Rename(partPath, localPath); err != nil {
+		return downloaded, false, fmt.Errorf("重命名文件失败: %v", err)
+	}
+	os.Remove(statePath)
+
+	mtime := meta.LocalMtime
+	if mtime == 0 {
+		mtime = meta.ServerMtime
+	}
+	if mtime > 0 {
+		t := time.Unix(mtime, 0)
+		os.Chtimes(localPath, t, t)
+	}
+	return downloaded, false, nil
+}
+
+// 待下载的文件
+type downloadTask struct {
+	FsId       uint64
+	RemotePath string
+	LocalPath  string
+	Size       int64
+}
+
+// 下载统计
+type DownloadStats struct {
+	TotalFiles      int64
+	DownloadedFiles int64
+	SkippedFiles    int64
+	FailedFiles     int64
+	DownloadedSize  int64
+	StartTime       time.Time
+}
+
+// 列出需要下载的文件，远程目录会镜像到 localDir/<目录名>/ 下
+func collectDownloadTasks(ctx context.Context, entry RemoteEntry, localDir string) ([]downloadTask, error) {
+	if !entry.IsDir {
+		return []downloadTask{{
+			FsId:       entry.FsId,
+			RemotePath: entry.Path,
+			LocalPath:  filepath.Join(localDir, entry.Name),
+			Size:       entry.Size,
+		}}, nil
+	}
+
+	entries, err := listAllRecursive(ctx, entry.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	localRoot := filepath.Join(localDir, entry.Name)
+	if err := os.MkdirAll(localRoot, 0755); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %v", err)
+	}
+
+	var tasks []downloadTask
+	for _, e := range entries {
+		rel := strings.TrimPrefix(e.Path, entry.Path+"/")
+		localPath := filepath.Join(localRoot, filepath.FromSlash(path.Clean("/"+rel)))
+		if e.IsDir() {
+			// 空目录也需要创建
+			if err := os.MkdirAll(localPath, 0755); err != nil {
+				return nil, fmt.Errorf("创建目录失败: %v", err)
+			}
+			continue
+		}
+		tasks = append(tasks, downloadTask{
+			FsId:       e.FsId,
+			RemotePath: e.Path,
+			LocalPath:  localPath,
+			Size:       int64(e.Size),
+		})
+	}
+	return tasks, nil
+}
+
+// 并发下载所有文件
+func downloadTasks(ctx context.Context, tasks []downloadTask, opts *DownloadOptions) error {
+	var totalSize int64
+	for _, task := range tasks {
+		totalSize += task.Size
+	}
+	stats := &DownloadStats{TotalFiles: int64(len(tasks)), StartTime: time.Now()}
+	fmt.Printf("共 %d 个文件，总大小: %s\n", len(tasks), formatFileSize(totalSize))
+
+	semaphore := make(chan struct{}, opts.MaxConcurrent)
+	var wg sync.WaitGroup
+	skipped := 0
+	for i, task := range tasks {
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			skipped = len(tasks) - i
+			break
+		}
+
+		wg.Add(1)
+		go func(task downloadTask) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			n, exists, err := downloadRemoteFile(ctx, task.FsId, task.LocalPath, opts)
+			atomic.AddInt64(&stats.DownloadedSize, n)
+			switch {
+			case err != nil:
+				atomic.AddInt64(&stats.FailedFiles, 1)
+				if ctx.Err() == nil {
+					logger.Error("❌ 下载失败: %s - %v", task.RemotePath, err)
+				}
+			case exists:
+				atomic.AddInt64(&stats.SkippedFiles, 1)
+				logger.Info("⏭️ 已存在，跳过: %s", task.LocalPath)
+			default:
+				atomic.AddInt64(&stats.DownloadedFiles, 1)
+				speed := float64(n) / math.Max(time.Since(start).Seconds(), 0.001)
+				logger.Info("✅ 下载完成: %s -> %s (%s, %s/s)", task.RemotePath, task.LocalPath, formatFileSize(task.Size), formatFileSize(int64(speed)))
+			}
+		}(task)
+	}
+	wg.Wait()
+
+	elapsed := time.Since(stats.StartTime)
+	fmt.Printf("\n下载完成: 成功 %d, 跳过 %d, 失败 %d, 传输 %s, 耗时 %s\n",
+		stats.DownloadedFiles, stats.SkippedFiles, stats.FailedFiles,
+		formatFileSize(stats.DownloadedSize), formatDuration(elapsed))
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("下载被中断，%d 个文件未开始，重新运行相同的命令即可继续下载: %w", skipped, ctx.Err())
+	}
+	if stats.FailedFiles > 0 {
+		return fmt.Errorf("有 %d 个文件下载失败", stats.FailedFiles)
+	}
+	return nil
+}
+
+// download [-o 本地目录] [-connections N] [-concurrent N] [-no-verify] <远程路径>
+func runDownload(args []string) int {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	outDir := fs.String("o", ".", "保存到的本地目录")
+	connections := fs.Int("connections", 4, "单个文件同时使用的连接数")
+	concurrent := fs.Int("concurrent", 3, "同时下载的文件数")
+	noVerify := fs.Bool("no-verify", false, "下载完成后不校验MD5（本地已有的文件只比较大小）")
+	deleteMismatch := fs.Bool("delete-mismatch", false, "MD5校验失败时删除下载的数据（默认保留为 .part 文件）")
+	config, err := setupRemoteCommand(fs, args)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	if fs.NArg() == 0 {
+		return commandFailed(context.Background(), fmt.Errorf("请指定远程路径: ./bddisk_uploader download [-o 本地目录] <远程路径>"))
+	}
+	if *connections < 1 || *concurrent < 1 {
+		return commandFailed(context.Background(), fmt.Errorf("-connections 和 -concurrent 必须大于0"))
+	}
+	opts := &DownloadOptions{Connections: *connections, MaxConcurrent: *concurrent, Verify: !*noVerify, DeleteMismatch: *deleteMismatch}
+
+	ctx, stop := remoteCommandContext()
+	defer stop()
+
+	entry, err := statRemote(ctx, config, remotePathArg(fs, config))
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+	tasks, err := collectDownloadTasks(ctx, entry, *outDir)
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+	if err := downloadTasks(ctx, tasks, opts); err != nil {
+		return commandFailed(ctx, err)
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+func TestFetchRangeStalled(t *testing.T) {
+	// 返回一半数据后不再发送，直到连接被关闭
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "8")
+		io.WriteString(w, "0123")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	expiresAt := time.Now().Add(time.Hour)
+	initSDKClients(&Config{AccessToken: "token", ExpiresAt: &expiresAt})
+	defer initSDKClients(&Config{})
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "file"+DownloadPartSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := &downloadRange{Start: 0, End: 8}
+	state := &downloadState{Size: 8, Ranges: []*downloadRange{r}, path: f.Name() + ".json"}
+
+	err = fetchRange(context.Background(), server.URL+"/file", f, r, state, 100*time.Millisecond)
+	var stallErr *utils.StallError
+	if !errors.As(err, &stallErr) || !isRetryableError(err) {
+		t.Fatalf("err = %v, want a retryable *utils.StallError", err)
+	}
+	// 重试时从已写入的位置继续
+	if r.Done != 4 {
+		t.Errorf("done = %d, want 4", r.Done)
+	}
+	if data, _ := os.ReadFile(f.Name()); string(data) != "0123" {
+		t.Errorf("file = %q, want %q", data, "0123")
+	}
+}
+
+func TestLocalFileMatchesSizeOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// filemetas的md5不一定是内容的MD5，已下载的文件只比较大小
+	if !localFileMatches(path, file.FileMeta{Size: 7, Md5: "d41d8cd98f00b204e9800998ecf8427e"}) {
+		t.Error("file with the same size should be skipped")
+	}
+	if localFileMatches(path, file.FileMeta{Size: 8}) {
+		t.Error("file with a different size should be downloaded")
+	}
+	if localFileMatches(filepath.Dir(path), file.FileMeta{Size: 7}) {
+		t.Error("directory should not match")
+	}
+}
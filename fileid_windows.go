@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Windows 下 os.FileInfo 不包含文件ID，只根据大小和修改时间判断
+func fileIdentity(info os.FileInfo) (dev, inode uint64) {
+	return 0, 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bddisk_uploader/logger"
+)
+
+const (
+	lockTimeout  = 40 * time.Second // 等待锁的最长时间
+	staleLockAge = 30 * time.Second // 持有锁的进程异常退出时，超过该时间的锁文件视为失效
+)
+
+// 原子写入文件：先写入同目录下的临时文件，再重命名覆盖目标文件，
+// 避免进程中断时留下只写了一半的文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// 通过独占创建 <path>.lock 实现的跨进程锁，返回释放锁的函数。
+// 锁文件中写入进程号和随机数，释放时只删除自己创建的锁文件：
+// 持有锁超过 staleLockAge 后锁可能已被其他进程接管，此时不能删除对方的锁
+func lockFile(path string) (func(), error) {
+	lockPath := path + ".lock"
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("生成锁标识失败: %v", err)
+	}
+	owner := fmt.Sprintf("%d %s\n", os.Getpid(), hex.EncodeToString(nonce))
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.WriteString(owner)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, fmt.Errorf("写入锁文件失败: %v", err)
+			}
+			return func() {
+				if data, err := os.ReadFile(lockPath); err == nil && string(data) == owner {
+					os.Remove(lockPath)
+				} else {
+					logger.Warn("锁文件 %s 已被其他进程接管，不再删除", lockPath)
+				}
+			}, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("创建锁文件失败: %v", err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("等待锁文件 %s 超时，如果没有其他进程在运行，请删除该文件", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
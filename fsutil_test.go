@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".lock"); err != nil {
+		t.Fatalf("lock file not created: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file not removed: %v", err)
+	}
+}
+
+func TestLockFileTakenOver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	lockPath := path + ".lock"
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 持有锁太久，其他进程认为锁已失效并接管
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlockOther, err := lockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 原来的持有者释放锁时不能删除新持有者的锁文件
+	unlock()
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Fatalf("lock taken over by another owner was removed: %v", err)
+	}
+	unlockOther()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file not removed: %v", err)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"bddisk_uploader/logger"
+)
+
+const (
+	IndexFileName     = "index.json" // 本地文件索引在缓存目录下的文件名
+	indexVersion      = 1
+	indexSaveEvery    = 100              // 累计这么多次修改后保存一次
+	indexSaveInterval = 30 * time.Second // 距上次保存超过该时间后保存一次
+)
+
+// 本地文件索引，记录已计算过的分片MD5和上传结果，文件未变化时无需重新读取
+type IndexEntry struct {
+	LocalPath  string    `json:"local_path"`
+	Size       int64     `json:"size"`
+	ModTime    int64     `json:"mtime"` // 纳秒
+	Dev        uint64    `json:"dev,omitempty"`
+	Inode      uint64    `json:"inode,omitempty"`
+	ChunkSize  int64     `json:"chunk_size,omitempty"`
+	BlockList  []string  `json:"block_list,omitempty"`
+	ContentMD5 string    `json:"content_md5,omitempty"`
+	SliceMD5   string    `json:"slice_md5,omitempty"`
+	RemotePath string    `json:"remote_path,omitempty"`
+	FsId       uint64    `json:"fs_id,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 文件大小、修改时间和inode都相同时认为文件未变化
+func (e *IndexEntry) matches(info os.FileInfo) bool {
+	if e.Size != info.Size() || e.ModTime != info.ModTime().UnixNano() {
+		return false
+	}
+	dev, inode := fileIdentity(info)
+	return e.Inode == 0 || inode == 0 || (e.Dev == dev && e.Inode == inode)
+}
+
+func newIndexEntry(localPath string, info os.FileInfo) *IndexEntry {
+	dev, inode := fileIdentity(info)
+	return &IndexEntry{
+		LocalPath: localPath,
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UnixNano(),
+		Dev:       dev,
+		Inode:     inode,
+	}
+}
+
+// FileIndex 保存在缓存目录的 index.json 中。
+// 未加载索引时为nil，上传时使用的查询、更新方法和 flush 可以在nil上调用
+type FileIndex struct {
+	Version int                    `json:"version"`
+	Entries map[string]*IndexEntry `json:"entries"` // 本地绝对路径 -> 索引项
+
+	path     string
+	mu       sync.Mutex
+	dirty    int
+	lastSave time.Time
+}
+
+// 上传时使用的本地文件索引，未加载时为nil
+var fileIndex *FileIndex
+
+func indexPath(cacheDir string) string {
+	return filepath.Join(cacheDir, IndexFileName)
+}
+
+// 加载本地文件索引，文件不存在或已损坏时返回空索引
+func loadFileIndex(cacheDir string) *FileIndex {
+	idx := &FileIndex{Version: indexVersion, Entries: make(map[string]*IndexEntry), path: indexPath(cacheDir), lastSave: time.Now()}
+	data, err := os.ReadFile(idx.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("读取本地文件索引失败，将重新建立: %v", err)
+		}
+		return idx
+	}
+
+	var loaded FileIndex
+	if err := json.Unmarshal(data, &loaded); err != nil || loaded.Version != indexVersion {
+		logger.Warn("本地文件索引已损坏或版本不兼容，将重新建立")
+		return idx
+	}
+	if loaded.Entries != nil {
+		idx.Entries = loaded.Entries
+	}
+	return idx
+}
+
+func indexKey(localPath string) string {
+	if absPath, err := filepath.Abs(localPath); err == nil {
+		return absPath
+	}
+	return localPath
+}
+
+// 查找与当前文件状态一致的索引项，返回副本
+func (x *FileIndex) lookup(localPath string, info os.FileInfo) *IndexEntry {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	e, ok := x.Entries[indexKey(localPath)]
+	if !ok || !e.matches(info) {
+		return nil
+	}
+	copied := *e
+	return &copied
+}
+
+// 获取文件的分片MD5，分片大小不同或文件已变化时返回nil
+func (x *FileIndex) digest(localPath string, info os.FileInfo, chunkSize int64) *FileDigest {
+	e := x.lookup(localPath, info)
+	if e == nil || e.ChunkSize != chunkSize || len(e.BlockList) == 0 || e.ContentMD5 == "" {
+		return nil
+	}
+	return &FileDigest{BlockList: e.BlockList, Size: uint64(e.Size), ContentMD5: e.ContentMD5, SliceMD5: e.SliceMD5}
+}
+
+// 修改与当前文件状态一致的索引项，文件已变化时丢弃旧的索引项
+func (x *FileIndex) update(localPath string, info os.FileInfo, fn func(e *IndexEntry)) {
+	if x == nil {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	key := indexKey(localPath)
+	e, ok := x.Entries[key]
+	if !ok || !e.matches(info) {
+		e = newIndexEntry(key, info)
+		x.Entries[key] = e
+	}
+	fn(e)
+	e.UpdatedAt = time.Now()
+	x.dirty++
+	if x.dirty >= indexSaveEvery || time.Since(x.lastSave) >= indexSaveInterval {
+		if err := x.saveLocked(); err != nil {
+			logger.Warn("保存本地文件索引失败: %v", err)
+		}
+	}
+}
+
+// 记录文件的分片MD5
+func (x *FileIndex) putDigest(localPath string, info os.FileInfo, chunkSize int64, digest *FileDigest) {
+	x.update(localPath, info, func(e *IndexEntry) {
+		e.ChunkSize = chunkSize
+		e.BlockList = digest.BlockList
+		e.ContentMD5 = digest.ContentMD5
+		e.SliceMD5 = digest.SliceMD5
+	})
+}
+
+// 记录整个文件的MD5
+func (x *FileIndex) putContentMD5(localPath string, info os.FileInfo, contentMD5 string) {
+	x.update(localPath, info, func(e *IndexEntry) {
+		e.ContentMD5 = contentMD5
+	})
+}
+
+// 记录文件上传到的远程路径和fs_id
+func (x *FileIndex) setRemote(localPath string, info os.FileInfo, remotePath string, fsId uint64) {
+	x.update(localPath, info, func(e *IndexEntry) {
+		e.RemotePath = remotePath
+		e.FsId = fsId
+	})
+}
+
+// 保存有修改的索引
+func (x *FileIndex) flush() error {
+	if x == nil {
+		return nil
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.dirty == 0 {
+		return nil
+	}
+	return x.saveLocked()
+}
+
+func (x *FileIndex) saveLocked() error {
+	data, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(x.path, data, 0644); err != nil {
+		return err
+	}
+	x.dirty = 0
+	x.lastSave = time.Now()
+	return nil
+}
+
+// 保存索引，失败时只输出警告
+func flushFileIndex() {
+	if err := fileIndex.flush(); err != nil {
+		logger.Warn("保存本地文件索引失败: %v", err)
+	}
+}
+
+// 按路径排序的索引项，prefix 不为空时只返回该路径下的文件
+func (x *FileIndex) sortedEntries(prefix string) []*IndexEntry {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entries := make([]*IndexEntry, 0, len(x.Entries))
+	for key, e := range x.Entries {
+		if prefix == "" || key == prefix || strings.HasPrefix(key, prefix+string(filepath.Separator)) {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].LocalPath < entries[j].LocalPath })
+	return entries
+}
+
+// 删除本地文件已不存在或已变化的索引项，返回删除的数量
+func (x *FileIndex) prune() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	removed := 0
+	for key, e := range x.Entries {
+		info, err := os.Stat(key)
+		if err != nil || info.IsDir() || !e.matches(info) {
+			delete(x.Entries, key)
+			removed++
+		}
+	}
+	x.dirty += removed
+	return removed
+}
+
+// 获取文件的分片MD5，优先使用索引，未命中时计算并记录
+func fileDigestWithIndex(localPath string, info os.FileInfo, chunkSize int64) (*FileDigest, error) {
+	if digest := fileIndex.digest(localPath, info, chunkSize); digest != nil {
+		logger.Debug("使用本地索引中的MD5: %s", localPath)
+		return digest, nil
+	}
+	digest, err := calculateFileDigest(localPath, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	fileIndex.putDigest(localPath, info, chunkSize, digest)
+	return digest, nil
+}
+
+// 获取整个文件的MD5，优先使用索引
+func contentMD5WithIndex(localPath string) (string, error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	if e := fileIndex.lookup(localPath, info); e != nil && e.ContentMD5 != "" {
+		return e.ContentMD5, nil
+	}
+	sum, err := fileMD5(localPath)
+	if err != nil {
+		return "", err
+	}
+	fileIndex.putContentMD5(localPath, info, sum)
+	return sum, nil
+}
+
+// 索引中记录的远程文件与当前远程文件一致时，说明本地文件上传后未再修改
+func uploadedUnchanged(localPath string, remotePath string, fsId uint64) bool {
+	if fileIndex == nil || fsId == 0 {
+		return false
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return false
+	}
+	e := fileIndex.lookup(localPath, info)
+	return e != nil && e.FsId == fsId && e.RemotePath == remotePath
+}
+
+// 输出索引项
+func printIndexEntries(entries []*IndexEntry) {
+	for _, e := range entries {
+		md5 := e.ContentMD5
+		if md5 == "" {
+			md5 = strings.Repeat("-", 32)
+		}
+		fmt.Printf("%10s  %s  %s", formatFileSize(e.Size), md5, e.LocalPath)
+		if e.RemotePath != "" {
+			fmt.Printf(" -> %s", e.RemotePath)
+			if e.FsId != 0 {
+				fmt.Printf(" (fs_id: %d)", e.FsId)
+			}
+		}
+		fmt.Println()
+	}
+}
+
+// 重新计算索引中所有文件以及dirs下所有文件的MD5，返回更新和删除的数量
+func rebuildFileIndex(x *FileIndex, dirs []string, chunkSize int64) (updated, removed int, err error) {
+	done := make(map[string]bool)
+	rehash := func(localPath string, info os.FileInfo, size int64) error {
+		digest, err := calculateFileDigest(localPath, size)
+		if err != nil {
+			return fmt.Errorf("计算文件MD5失败 %s: %v", localPath, err)
+		}
+		x.putDigest(localPath, info, size, digest)
+		done[indexKey(localPath)] = true
+		updated++
+		return nil
+	}
+
+	for _, e := range x.sortedEntries("") {
+		info, statErr := os.Stat(e.LocalPath)
+		if statErr != nil || info.IsDir() {
+			x.mu.Lock()
+			delete(x.Entries, e.LocalPath)
+			x.dirty++
+			x.mu.Unlock()
+			removed++
+			continue
+		}
+		size := chunkSize
+		if size == 0 {
+			size = e.ChunkSize
+		}
+		if size == 0 {
+			size = ChunkSize
+		}
+		if err := rehash(e.LocalPath, info, size); err != nil {
+			return updated, removed, err
+		}
+	}
+
+	if chunkSize == 0 {
+		chunkSize = ChunkSize
+	}
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				logger.Warn("警告: 访问文件失败 %s: %v", path, err)
+				return nil
+			}
+			if info.IsDir() || shouldExcludeFile(path, nil) {
+				return nil
+			}
+			// 已经按索引中的分片大小重新计算过的文件跳过
+			if done[indexKey(path)] {
+				return nil
+			}
+			return rehash(path, info, chunkSize)
+		})
+		if err != nil {
+			return updated, removed, err
+		}
+	}
+	return updated, removed, nil
+}
+
+// index show|rebuild|prune [-cache-dir 目录]
+func runIndex(args []string) int {
+	if err := logger.InitWithConsole(logger.INFO, os.Stderr, "", false); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	if len(args) == 0 {
+		return commandFailed(context.Background(), fmt.Errorf("用法: ./bddisk_uploader index show|rebuild|prune [-cache-dir 目录]"))
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("index "+action, flag.ExitOnError)
+	cacheDir := fs.String("cache-dir", "", "缓存目录（默认使用当前目录下的.chunks）")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出（show）")
+	addConfigFlags(fs)
+	chunkSizeMB := fs.Int("chunk-size", 0, "重新计算时使用的分片大小，单位MB（rebuild，默认沿用索引中的分片大小，新文件使用4）")
+	if err := fs.Parse(args[1:]); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+
+	actualCacheDir, err := getCacheDir(*cacheDir)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	idx := loadFileIndex(actualCacheDir)
+
+	switch action {
+	case "show":
+		prefix := ""
+		if fs.NArg() > 0 {
+			prefix = indexKey(fs.Arg(0))
+		}
+		entries := idx.sortedEntries(prefix)
+		if *jsonOutput {
+			if err := printJSON(entries); err != nil {
+				return commandFailed(context.Background(), err)
+			}
+			return 0
+		}
+		printIndexEntries(entries)
+		fmt.Printf("\n共 %d 个文件，索引文件: %s\n", len(entries), idx.path)
+		return 0
+
+	case "rebuild":
+		if *chunkSizeMB < 0 {
+			return commandFailed(context.Background(), fmt.Errorf("-chunk-size 不能为负数"))
+		}
+		updated, removed, err := rebuildFileIndex(idx, fs.Args(), int64(*chunkSizeMB)*1024*1024)
+		if flushErr := idx.flush(); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		fmt.Printf("已重新计算 %d 个文件，删除 %d 个失效的索引项\n", updated, removed)
+		return 0
+
+	case "prune":
+		removed := idx.prune()
+		if err := idx.flush(); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		fmt.Printf("已删除 %d 个失效的索引项，剩余 %d 个\n", removed, len(idx.sortedEntries("")))
+		return 0
+	}
+	return commandFailed(context.Background(), fmt.Errorf("未知的操作: %s，可用操作: show、rebuild、prune", action))
+}
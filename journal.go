@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bddisk_uploader/logger"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+)
+
+const (
+	JournalDirName = "journal"      // 上传日志在缓存目录下的子目录
+	UploadIdMaxAge = 48 * time.Hour // 超过该时间的上传ID视为失效，重新开始上传
+)
+
+// 上传日志，记录单个文件的上传进度，进程退出后可据此继续上传。
+// <hash>.json 保存文件信息和分片列表，之后完成的分片追加到 <hash>.parts，
+// 避免每完成一个分片都重写整个日志；加载时将 .parts 合并回 .json
+type UploadJournal struct {
+	LocalPath  string         `json:"local_path"`
+	RemotePath string         `json:"remote_path"`
+	Size       uint64         `json:"size"`
+	ModTime    time.Time      `json:"mtime"`
+	ChunkSize  int64          `json:"chunk_size"`
+	BlockList  []string       `json:"block_list"`
+	UploadId   string         `json:"uploadid"`
+	Completed  map[int]string `json:"completed"` // 已完成的分片序号 -> 服务端返回的MD5
+	CreatedAt  time.Time      `json:"created_at"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// 上传日志文件路径，由本地绝对路径和远程路径共同决定
+func journalPath(cacheDir, localPath, remotePath string) string {
+	if absPath, err := filepath.Abs(localPath); err == nil {
+		localPath = absPath
+	}
+	sum := sha1.Sum([]byte(localPath + "\x00" + remotePath))
+	return filepath.Join(cacheDir, JournalDirName, hex.EncodeToString(sum[:])+".json")
+}
+
+// 创建新的上传日志
+func newUploadJournal(path, localPath, remotePath string, fileInfo os.FileInfo, chunkSize int64, blockList []string, uploadId string) *UploadJournal {
+	if absPath, err := filepath.Abs(localPath); err == nil {
+		localPath = absPath
+	}
+	return &UploadJournal{
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Size:       uint64(fileInfo.Size()),
+		ModTime:    fileInfo.ModTime(),
+		ChunkSize:  chunkSize,
+		BlockList:  blockList,
+		UploadId:   uploadId,
+		Completed:  make(map[int]string),
+		CreatedAt:  time.Now(),
+		path:       path,
+	}
+}
+
+// 加载可继续使用的上传日志，文件已变化或上传ID已过期时删除日志并返回nil
+func loadResumableJournal(path string, fileInfo os.FileInfo) *UploadJournal {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	var journal UploadJournal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		logger.Warn("上传日志已损坏，重新开始上传: %v", err)
+		os.Remove(path)
+		os.Remove(partsLogPath(path))
+		return nil
+	}
+	journal.path = path
+	if journal.Completed == nil {
+		journal.Completed = make(map[int]string)
+	}
+	if journal.loadPartsLog() > 0 {
+		if err := journal.save(); err != nil {
+			logger.Warn("合并上传日志失败: %v", err)
+		}
+	}
+
+	switch {
+	case journal.Size != uint64(fileInfo.Size()) || !journal.ModTime.Equal(fileInfo.ModTime()):
+		logger.Info("文件自上次上传后已修改，重新开始上传")
+	case time.Since(journal.CreatedAt) > UploadIdMaxAge:
+		logger.Info("上次上传的上传ID已过期，重新开始上传")
+	case journal.UploadId == "" || len(journal.BlockList) == 0:
+		logger.Debug("上传日志不完整，重新开始上传")
+	default:
+		return &journal
+	}
+	journal.remove()
+	return nil
+}
+
+// 上传时使用的分片大小，旧版本的日志没有记录该字段，使用默认的4MB
+func (j *UploadJournal) chunkSize() int64 {
+	if j.ChunkSize <= 0 {
+		return ChunkSize
+	}
+	return j.ChunkSize
+}
+
+// 完成的分片记录，每行为 "<分片序号> <MD5>"
+func partsLogPath(journalPath string) string {
+	return strings.TrimSuffix(journalPath, ".json") + ".parts"
+}
+
+// 合并分片记录中的已完成分片，返回读取到的记录数。
+// 进程中断时最后一行可能不完整，跳过无法解析的行
+func (j *UploadJournal) loadPartsLog() int {
+	data, err := os.ReadFile(partsLogPath(j.path))
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, line := range strings.Split(string(data), "\n") {
+		seqText, md5, ok := strings.Cut(line, " ")
+		partSeq, err := strconv.Atoi(seqText)
+		if !ok || err != nil || partSeq < 0 || partSeq >= len(j.BlockList) || md5 == "" {
+			continue
+		}
+		j.Completed[partSeq] = md5
+		count++
+	}
+	return count
+}
+
+// 保存完整的上传日志，并清空已合并的分片记录
+func (j *UploadJournal) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化上传日志失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return fmt.Errorf("创建上传日志目录失败: %v", err)
+	}
+	if err := writeFileAtomic(j.path, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Remove(partsLogPath(j.path)); err != nil && !os.IsNotExist(err) {
+		logger.Debug("删除分片记录失败: %v", err)
+	}
+	return nil
+}
+
+// 记录已完成的分片，追加到分片记录并立即写入磁盘
+func (j *UploadJournal) markCompleted(partSeq int, md5 string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Completed[partSeq] = md5
+
+	f, err := os.OpenFile(partsLogPath(j.path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err == nil {
+		_, err = fmt.Fprintf(f, "%d %s\n", partSeq, md5)
+		if err == nil {
+			err = f.Sync()
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logger.Warn("保存上传进度失败: %v", err)
+	}
+}
+
+// 尚未上传的分片序号
+func (j *UploadJournal) pendingParts() []int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var pending []int
+	for partSeq := range j.BlockList {
+		if _, ok := j.Completed[partSeq]; !ok {
+			pending = append(pending, partSeq)
+		}
+	}
+	sort.Ints(pending)
+	return pending
+}
+
+// 已完成分片的总字节数
+func (j *UploadJournal) completedSize() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	chunkSize := j.chunkSize()
+	var size int64
+	for partSeq := range j.Completed {
+		partSize := int64(j.Size) - int64(partSeq)*chunkSize
+		if partSize > chunkSize {
+			partSize = chunkSize
+		}
+		size += partSize
+	}
+	return size
+}
+
+// 删除上传日志
+func (j *UploadJournal) remove() {
+	for _, path := range []string{j.path, partsLogPath(j.path)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Debug("删除上传日志失败: %s - %v", path, err)
+		}
+	}
+}
+
+// 判断继续上传失败后是否应该放弃上传日志、重新开始上传：
+// 上传ID失效、分片缺失等接口错误需要重新开始，网络错误和授权错误则保留日志
+func shouldRestartUpload(err error) bool {
+	var apiErr *errno.APIError
+	if !errors.As(err, &apiErr) || apiErr.Temporary() {
+		return false
+	}
+	return !errors.Is(err, errno.ErrTokenInvalid) && !errors.Is(err, errno.ErrTokenExpired)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 创建测试用的源文件和对应的上传日志
+func newTestJournal(t *testing.T) (*UploadJournal, os.FileInfo) {
+	t.Helper()
+	dir := t.TempDir()
+	localPath := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(localPath, make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, err := os.Stat(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := journalPath(dir, localPath, "/apps/test/a.bin")
+	journal := newUploadJournal(path, localPath, "/apps/test/a.bin", fileInfo, 4, []string{"m0", "m1", "m2"}, "up1")
+	if err := journal.save(); err != nil {
+		t.Fatal(err)
+	}
+	return journal, fileInfo
+}
+
+func TestJournalResume(t *testing.T) {
+	journal, fileInfo := newTestJournal(t)
+	header, err := os.ReadFile(journal.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal.markCompleted(0, "r0")
+	journal.markCompleted(2, "r2")
+
+	// 完成分片只追加到分片记录，不重写日志
+	if after, _ := os.ReadFile(journal.path); string(after) != string(header) {
+		t.Error("markCompleted rewrote the journal file")
+	}
+
+	resumed := loadResumableJournal(journal.path, fileInfo)
+	if resumed == nil {
+		t.Fatal("journal not resumable")
+	}
+	if resumed.Completed[0] != "r0" || resumed.Completed[2] != "r2" || len(resumed.Completed) != 2 {
+		t.Errorf("Completed = %v", resumed.Completed)
+	}
+	if pending := resumed.pendingParts(); len(pending) != 1 || pending[0] != 1 {
+		t.Errorf("pendingParts = %v, want [1]", pending)
+	}
+	if got := resumed.completedSize(); got != 6 {
+		t.Errorf("completedSize = %d, want 6", got)
+	}
+
+	// 加载时合并并删除分片记录
+	if _, err := os.Stat(partsLogPath(journal.path)); !os.IsNotExist(err) {
+		t.Errorf("parts log not compacted: %v", err)
+	}
+	again := loadResumableJournal(journal.path, fileInfo)
+	if again == nil || len(again.Completed) != 2 {
+		t.Fatalf("reloaded journal = %+v", again)
+	}
+}
+
+func TestJournalPartsLogTruncated(t *testing.T) {
+	journal, fileInfo := newTestJournal(t)
+	journal.markCompleted(1, "r1")
+
+	// 模拟写入最后一行时进程中断，以及超出范围的记录
+	f, err := os.OpenFile(partsLogPath(journal.path), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("7 bad\n2")
+	f.Close()
+
+	resumed := loadResumableJournal(journal.path, fileInfo)
+	if resumed == nil {
+		t.Fatal("journal not resumable")
+	}
+	if len(resumed.Completed) != 1 || resumed.Completed[1] != "r1" {
+		t.Errorf("Completed = %v, want only part 1", resumed.Completed)
+	}
+}
+
+func TestJournalModifiedFile(t *testing.T) {
+	journal, _ := newTestJournal(t)
+	journal.markCompleted(0, "r0")
+
+	if err := os.WriteFile(journal.LocalPath, make([]byte, 11), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, err := os.Stat(journal.LocalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loadResumableJournal(journal.path, fileInfo) != nil {
+		t.Fatal("journal of a modified file should not be resumed")
+	}
+	for _, path := range []string{journal.path, partsLogPath(journal.path)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", path)
+		}
+	}
+}
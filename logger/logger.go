@@ -49,9 +49,23 @@ func Init(level LogLevel, logFile string, showProgress bool) error {
 	return err
 }
 
+// InitWithConsole 初始化默认日志器，控制台输出写入console（如os.Stderr）
+func InitWithConsole(level LogLevel, console io.Writer, logFile string, showProgress bool) error {
+	var err error
+	once.Do(func() {
+		defaultLogger, err = NewLoggerWithConsole(level, console, logFile, showProgress)
+	})
+	return err
+}
+
 // NewLogger 创建新的日志器
 func NewLogger(level LogLevel, logFile string, showProgress bool) (*Logger, error) {
-	writers := []io.Writer{os.Stdout}
+	return NewLoggerWithConsole(level, os.Stdout, logFile, showProgress)
+}
+
+// NewLoggerWithConsole 创建新的日志器，控制台输出写入console
+func NewLoggerWithConsole(level LogLevel, console io.Writer, logFile string, showProgress bool) (*Logger, error) {
+	writers := []io.Writer{console}
 
 	// 如果指定了日志文件，同时写入文件
 	if logFile != "" {
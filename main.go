@@ -1,26 +1,36 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"bddisk_uploader/logger"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/download"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/filemanager"
 	"icode.baidu.com/baidu/xpan/go-sdk/xpan/upload"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/user"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
 )
 
 const (
-	ChunkSize       = 4 * 1024 * 1024 // 4MB分片大小
+	ChunkSize       = 4 * 1024 * 1024 // 默认分片大小4MB，也是允许的最小分片大小
 	ConfigFile      = "config.json"
 	MaxRetries      = 3               // 最大重试次数
 	BaseRetryDelay  = 1 * time.Second // 基础重试延迟
@@ -28,41 +38,61 @@ const (
 )
 
 type Config struct {
-	AccessToken  string       `json:"access_token"`
+	AccessToken  string       `json:"access_token,omitempty"`
 	RefreshToken string       `json:"refresh_token,omitempty"`
 	ExpiresAt    *time.Time   `json:"expires_at,omitempty"`
 	AppPath      string       `json:"app_path"` // 应用路径前缀，如 "/apps/your_app_name/"
 	OAuth        *OAuthConfig `json:"oauth,omitempty"`
+	APIHost      string       `json:"api_host,omitempty"`    // 可选，覆盖默认的 pan.baidu.com
+	UploadHost   string       `json:"upload_host,omitempty"` // 可选，覆盖默认的 d.pcs.baidu.com
+	// 可选，git风格的外部凭据程序，设置后token和client_secret由该程序保存，而不是凭据文件
+	CredentialHelper string `json:"credential_helper,omitempty"`
+	ServeToken       string `json:"serve_token,omitempty"` // serve 接口的访问token，保存在凭据存储中
 }
 
-// 加载配置文件
-func loadConfig() (*Config, error) {
-	configData, err := os.ReadFile(ConfigFile)
-	if err != nil {
-		return nil, fmt.Errorf("读取配置文件失败: %v", err)
-	}
+// 上传使用的SDK客户端，加载配置后由 initSDKClients 重新创建
+var uploadClient = upload.NewClient()
 
-	var config Config
-	if err := json.Unmarshal(configData, &config); err != nil {
-		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+// 根据配置生成SDK客户端选项
+func sdkOptions(config *Config) []utils.Option {
+	var opts []utils.Option
+	if config.APIHost != "" {
+		opts = append(opts, utils.WithAPIHost(config.APIHost))
 	}
-
-	if config.AccessToken == "" {
-		return nil, fmt.Errorf("配置文件中缺少access_token")
+	if config.UploadHost != "" {
+		opts = append(opts, utils.WithUploadHost(config.UploadHost))
 	}
+	return opts
+}
 
-	if config.AppPath == "" {
-		config.AppPath = "/apps/baidu_netdisk_uploader/"
+// 根据配置重新创建所有SDK客户端和access_token来源
+func initSDKClients(config *Config) {
+	tokens = newTokenSource(config)
+	opts := sdkOptions(config)
+	uploadClient = upload.NewClient(opts...)
+	userClient = user.NewClient(opts...)
+	fileClient = file.NewClient(opts...)
+	downloadClient = download.NewClient(opts...)
+	filemanagerClient = filemanager.NewClient(opts...)
+}
+
+// 加载配置文件中当前profile的配置
+func loadConfig() (*Config, error) {
+	config, err := loadProfileConfig()
+	if err != nil {
+		return nil, err
 	}
 
-	return &config, nil
+	if err := validateConfig(config, true, false); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 // 创建默认配置文件
 func createDefaultConfig() error {
 	config := Config{
-		AccessToken: "your_access_token_here",
-		AppPath:     "/apps/baidu_netdisk_uploader/",
+		AppPath: "/apps/baidu_netdisk_uploader/",
 		OAuth: &OAuthConfig{
 			ClientID:     "your_app_key_here",
 			ClientSecret: "your_secret_key_here",
@@ -71,45 +101,66 @@ func createDefaultConfig() error {
 		},
 	}
 
-	configData, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return err
+	// 重新初始化时保留已添加的其他profile
+	data := &configFileData{}
+	if existing, err := readConfigFile(); err == nil {
+		data = existing
 	}
+	data.Config = config
+	return writeConfigFile(data)
+}
 
-	return os.WriteFile(ConfigFile, configData, 0644)
+// 文件摘要
+type FileDigest struct {
+	BlockList  []string // 每个分片的MD5
+	Size       uint64
+	ContentMD5 string // 整个文件的MD5，用于秒传
+	SliceMD5   string // 文件前256KB的MD5，用于秒传
 }
 
-// 计算文件分片的MD5值
-func calculateFileMD5Chunks(filePath string) ([]string, uint64, error) {
+// 按chunkSize计算文件分片的MD5值，同时计算秒传所需的整文件MD5和前256KB的MD5
+func calculateFileDigest(filePath string, chunkSize int64) (*FileDigest, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer file.Close()
 
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	fileSize := uint64(fileInfo.Size())
-	var md5List []string
-	buffer := make([]byte, ChunkSize)
+	digest := &FileDigest{Size: uint64(fileInfo.Size())}
+	contentHash := md5.New()
+	buffer := make([]byte, chunkSize)
 
 	for {
-		n, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, 0, err
+		// 每个分片必须读满chunkSize（最后一片除外），与上传时的分片偏移保持一致
+		n, err := io.ReadFull(file, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
 		}
 		if n == 0 {
 			break
 		}
 
+		if digest.BlockList == nil {
+			sliceLen := n
+			if sliceLen > upload.RapidUploadSliceSize {
+				sliceLen = upload.RapidUploadSliceSize
+			}
+			sliceHash := md5.Sum(buffer[:sliceLen])
+			digest.SliceMD5 = hex.EncodeToString(sliceHash[:])
+		}
+		contentHash.Write(buffer[:n])
+
 		hash := md5.Sum(buffer[:n])
-		md5List = append(md5List, hex.EncodeToString(hash[:]))
+		digest.BlockList = append(digest.BlockList, hex.EncodeToString(hash[:]))
 	}
+	digest.ContentMD5 = hex.EncodeToString(contentHash.Sum(nil))
 
-	return md5List, fileSize, nil
+	return digest, nil
 }
 
 // 获取缓存目录，如果不存在则创建
@@ -126,6 +177,10 @@ func getCacheDir(customCacheDir string) (string, error) {
 			return "", fmt.Errorf("获取当前目录失败: %v", err)
 		}
 		cacheDir = filepath.Join(currentDir, DefaultCacheDir)
+		// 其他账号的上传进度、索引和任务队列分开保存，避免在账号之间续传
+		if profile := currentProfile(); profile != DefaultProfile {
+			cacheDir = filepath.Join(cacheDir, "profiles", profile)
+		}
 	}
 
 	// 确保缓存目录存在
@@ -136,57 +191,14 @@ func getCacheDir(customCacheDir string) (string, error) {
 	return cacheDir, nil
 }
 
-// 创建文件分片
-func createFileChunks(filePath, cacheDir string) ([]string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	var chunkFiles []string
-	buffer := make([]byte, ChunkSize)
-	chunkIndex := 0
-
-	// 获取原文件的基本名称（不包含路径）
-	baseFileName := filepath.Base(filePath)
-
-	for {
-		n, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, err
-		}
-		if n == 0 {
-			break
-		}
-
-		// 在缓存目录下创建分片文件，使用原文件名和进程ID确保唯一性
-		chunkFileName := filepath.Join(cacheDir, fmt.Sprintf("%s.%d.chunk.%d", baseFileName, os.Getpid(), chunkIndex))
-		chunkFile, err := os.Create(chunkFileName)
-		if err != nil {
-			return nil, err
-		}
-
-		_, err = chunkFile.Write(buffer[:n])
-		chunkFile.Close()
-		if err != nil {
-			return nil, err
-		}
-
-		chunkFiles = append(chunkFiles, chunkFileName)
-		chunkIndex++
-	}
-
-	return chunkFiles, nil
-}
-
-// 清理临时分片文件
-func cleanupChunks(chunkFiles []string) {
-	if len(chunkFiles) == 0 {
+// 清理旧版本遗留在缓存目录中的临时分片文件
+func cleanupStaleChunks(cacheDir string) {
+	chunkFiles, err := filepath.Glob(filepath.Join(cacheDir, "*.chunk.*"))
+	if err != nil || len(chunkFiles) == 0 {
 		return
 	}
 
-	logger.Info("正在清理 %d 个分片文件...", len(chunkFiles))
+	logger.Info("正在清理 %d 个遗留的分片文件...", len(chunkFiles))
 	cleanedCount := 0
 	for _, chunkFile := range chunkFiles {
 		if err := os.Remove(chunkFile); err != nil {
@@ -203,34 +215,113 @@ func isRetryableError(err error) bool {
 	if err == nil {
 		return false
 	}
-	errStr := strings.ToLower(err.Error())
-
-	// 可重试的错误类型
-	retryableErrors := []string{
-		"timeout",
-		"connection reset",
-		"connection refused",
-		"network unreachable",
-		"temporary failure",
-		"502 bad gateway",
-		"503 service unavailable",
-		"504 gateway timeout",
-		"500 internal server error",
-		"i/o timeout",
-		"eof",
-		"broken pipe",
-	}
-
-	for _, retryable := range retryableErrors {
-		if strings.Contains(errStr, retryable) {
-			return true
-		}
+	// 主动取消的请求不再重试
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// 接口返回的错误根据错误码判断：频控和服务端错误可以重试
+	var apiErr *errno.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+
+	// 网络层错误（超时、连接被重置等）可以重试
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// 根据接口错误码给出处理建议
+func errorHint(err error) string {
+	switch {
+	case errors.Is(err, errno.ErrTokenInvalid), errors.Is(err, errno.ErrTokenExpired):
+		return "access_token无效或已过期，请运行: ./bddisk_uploader -refresh-token" + profileFlagHint() + " 或重新授权 -auth" + profileFlagHint()
+	case errors.Is(err, errno.ErrPathIllegal):
+		return "上传路径非法，请检查配置文件中的app_path是否以 /apps/应用名/ 开头，以及文件名是否包含非法字符"
+	case errors.Is(err, errno.ErrQuotaExceeded):
+		return "网盘容量已满，请清理空间后重试"
+	case errors.Is(err, errno.ErrFileTooLarge):
+		return "文件大小超过账号的单文件上限"
+	case errors.Is(err, errno.ErrFrequencyControl):
+		return "请求过于频繁，请降低并发数（-concurrent）后稍后重试"
+	case errors.Is(err, errno.ErrNoPermission):
+		return "应用没有访问权限，请确认授权范围包含netdisk"
+	}
+	return ""
+}
+
+// 上传选项
+type UploadOptions struct {
+	PartConcurrency int    // 单个文件同时上传的分片数
+	RapidUpload     bool   // 上传前先尝试秒传
+	ChunkSize       int64  // 分片大小，由账号等级决定
+	MaxFileSize     int64  // 单文件大小上限，为0时不检查
+	AccountName     string // 账号等级名称，用于错误提示
+	Overwrite       bool   // 远程已有同名文件时覆盖，而不是重命名
+
+	// 可选，每完成一部分上传时调用，n为新完成的字节数
+	OnProgress func(localPath string, n int64)
+
+	// 全局分片上传连接数限制，所有文件共享，为nil时不限制
+	connLimiter chan struct{}
+}
+
+// 创建上传选项，maxConnections 为所有文件同时进行的分片上传总数上限
+func newUploadOptions(partConcurrency, maxConnections int, rapidUpload bool) *UploadOptions {
+	if partConcurrency < 1 {
+		partConcurrency = 1
+	}
+	opts := &UploadOptions{PartConcurrency: partConcurrency, RapidUpload: rapidUpload, ChunkSize: ChunkSize}
+	if maxConnections > 0 {
+		opts.connLimiter = make(chan struct{}, maxConnections)
+	}
+	return opts
+}
+
+// 远程路径冲突时的处理策略
+func (o *UploadOptions) rtype() string {
+	if o.Overwrite {
+		return upload.RtypeOverwrite
+	}
+	return upload.RtypeRenameIfDiff
+}
+
+// 报告上传进度
+func (o *UploadOptions) reportProgress(localPath string, n int64) {
+	if o.OnProgress != nil && n > 0 {
+		o.OnProgress(localPath, n)
+	}
+}
+
+// 获取一个分片上传连接，ctx取消时返回错误
+func (o *UploadOptions) acquireConn(ctx context.Context) error {
+	if o.connLimiter == nil {
+		return nil
+	}
+	select {
+	case o.connLimiter <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 释放分片上传连接
+func (o *UploadOptions) releaseConn() {
+	if o.connLimiter != nil {
+		<-o.connLimiter
 	}
-	return false
 }
 
-// 带重试的分片上传函数
-func uploadChunkWithRetry(accessToken string, uploadArg *upload.UploadArg, partSeq int) (upload.UploadReturn, error) {
+// 带重试的分片上传函数，ctx取消时中止正在进行的请求和重试等待
+func uploadChunkWithRetry(ctx context.Context, uploadArg *upload.UploadPartArg, partSeq int, opts *UploadOptions) (upload.UploadReturn, error) {
 	var lastErr error
 
 	for attempt := 0; attempt <= MaxRetries; attempt++ {
@@ -242,11 +333,24 @@ func uploadChunkWithRetry(accessToken string, uploadArg *upload.UploadArg, partS
 			}
 
 			logger.Warn("分片 %d 第 %d 次重试，等待 %v...", partSeq+1, attempt, delay)
-			time.Sleep(delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return upload.UploadReturn{}, ctx.Err()
+			}
 			logger.Debug("分片 %d 开始重试", partSeq+1)
 		}
 
-		result, err := upload.Upload(accessToken, uploadArg)
+		// 重试等待期间不占用连接
+		if err := opts.acquireConn(ctx); err != nil {
+			return upload.UploadReturn{}, err
+		}
+		var result upload.UploadReturn
+		err := withToken(func(accessToken string) (err error) {
+			result, err = uploadClient.UploadPartWithContext(ctx, accessToken, uploadArg)
+			return err
+		})
+		opts.releaseConn()
 		if err == nil {
 			if attempt > 0 {
 				logger.Info("分片 %d 重试成功！", partSeq+1)
@@ -254,6 +358,11 @@ func uploadChunkWithRetry(accessToken string, uploadArg *upload.UploadArg, partS
 			return result, nil
 		}
 
+		// 被取消时不再重试
+		if ctx.Err() != nil {
+			return upload.UploadReturn{}, ctx.Err()
+		}
+
 		lastErr = err
 
 		// 如果是不可重试的错误，直接返回
@@ -265,105 +374,292 @@ func uploadChunkWithRetry(accessToken string, uploadArg *upload.UploadArg, partS
 		logger.Warn("分片 %d 上传失败 (尝试 %d/%d): %v", partSeq+1, attempt+1, MaxRetries+1, err)
 	}
 
-	return upload.UploadReturn{}, fmt.Errorf("分片 %d 上传失败，已尝试 %d 次: %v", partSeq, MaxRetries+1, lastErr)
+	return upload.UploadReturn{}, fmt.Errorf("分片 %d 上传失败，已尝试 %d 次: %w", partSeq, MaxRetries+1, lastErr)
 }
 
-// 上传文件到百度网盘
-func uploadFileWithCacheDir(config *Config, localFilePath, remoteFileName, cacheDir string) error {
+// 上传文件到百度网盘，分片直接从源文件流式读取，ctx取消时中止上传。
+// 上传进度记录在缓存目录的上传日志中，中断后重新运行会从未完成的分片继续
+func uploadFileWithCacheDir(ctx context.Context, config *Config, localFilePath, remoteFileName, cacheDir string, opts *UploadOptions) error {
+	// 构建远程路径
+	remotePath := filepath.Join(config.AppPath, remoteFileName)
+	remotePath = strings.ReplaceAll(remotePath, "\\", "/") // 确保使用Unix风格路径
+
+	fileInfo, err := os.Stat(localFilePath)
+	if err != nil {
+		return fmt.Errorf("获取文件信息失败: %w", err)
+	}
+	if err := checkFileSizeLimit(fileInfo.Size(), opts); err != nil {
+		return err
+	}
+
+	// 存在未完成的上传时直接继续，无需重新计算MD5和预创建
+	journalFile := journalPath(cacheDir, localFilePath, remotePath)
+	if journal := loadResumableJournal(journalFile, fileInfo); journal != nil {
+		logger.Info("继续上次未完成的上传，已完成 %d/%d 个分片", len(journal.Completed), len(journal.BlockList))
+		err := uploadWithJournal(ctx, localFilePath, journal, opts)
+		if err == nil || ctx.Err() != nil || !shouldRestartUpload(err) {
+			return err
+		}
+		logger.Warn("继续上传失败，上传ID可能已失效，重新开始上传: %v", err)
+		journal.remove()
+	}
+
 	// 计算文件MD5分片
 	logger.Progress("正在计算文件MD5分片...")
-	md5List, fileSize, err := calculateFileMD5Chunks(localFilePath)
+	digest, err := fileDigestWithIndex(localFilePath, fileInfo, opts.ChunkSize)
 	if err != nil {
-		return fmt.Errorf("计算文件MD5失败: %v", err)
+		return fmt.Errorf("计算文件MD5失败: %w", err)
 	}
+	md5List, fileSize := digest.BlockList, digest.Size
 	logger.Info("完成，文件大小: %d 字节，分片数: %d", fileSize, len(md5List))
 
-	// 构建远程路径
-	remotePath := filepath.Join(config.AppPath, remoteFileName)
-	remotePath = strings.ReplaceAll(remotePath, "\\", "/") // 确保使用Unix风格路径
+	// 先尝试秒传，服务端没有相同内容时再分片上传
+	if opts.RapidUpload && fileSize >= upload.RapidUploadSliceSize {
+		done, err := tryRapidUpload(ctx, localFilePath, fileInfo, remotePath, digest, opts)
+		if err != nil {
+			return err
+		}
+		if done {
+			opts.reportProgress(localFilePath, int64(fileSize))
+			return nil
+		}
+	}
 
 	// 1. Precreate - 预创建文件
 	logger.Progress("正在预创建文件...")
 	precreateArg := upload.NewPrecreateArg(remotePath, fileSize, md5List)
-	precreateResult, err := upload.Precreate(config.AccessToken, precreateArg)
+	precreateArg.Rtype = opts.rtype()
+	precreateArg.LocalMtime = fileInfo.ModTime().Unix()
+	var precreateResult upload.PrecreateReturn
+	err = withToken(func(accessToken string) (err error) {
+		precreateResult, err = uploadClient.PrecreateWithContext(ctx, accessToken, precreateArg)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("预创建文件失败: %v", err)
+		return fmt.Errorf("预创建文件失败: %w", err)
 	}
 	logger.Debug("完成，上传ID: %s", precreateResult.UploadId)
 
 	if precreateResult.ReturnType == 2 {
 		logger.Info("文件已存在，无需重复上传")
+		opts.reportProgress(localFilePath, int64(fileSize))
 		return nil
 	}
 
-	// 创建临时分片文件
-	logger.Progress("正在创建文件分片...")
-	chunkFiles, err := createFileChunks(localFilePath, cacheDir)
-	if err != nil {
-		return fmt.Errorf("创建文件分片失败: %v", err)
-	}
-	defer cleanupChunks(chunkFiles)
-	logger.Debug("完成，共创建 %d 个分片", len(chunkFiles))
-
-	// 2. Upload - 上传需要的分片（带重试）
+	// 记录上传日志，服务端未要求上传的分片视为已完成
+	journal := newUploadJournal(journalFile, localFilePath, remotePath, fileInfo, opts.ChunkSize, md5List, precreateResult.UploadId)
+	needed := make(map[int]bool, len(precreateResult.BlockList))
 	for _, partSeq := range precreateResult.BlockList {
-		if partSeq >= len(chunkFiles) {
+		if partSeq < 0 || partSeq >= len(md5List) {
 			return fmt.Errorf("分片序号 %d 超出范围", partSeq)
 		}
+		needed[partSeq] = true
+	}
+	for partSeq, md5 := range md5List {
+		if !needed[partSeq] {
+			journal.Completed[partSeq] = md5
+		}
+	}
+	if err := journal.save(); err != nil {
+		logger.Warn("保存上传日志失败，本次上传中断后将无法继续: %v", err)
+	}
 
-		logger.Progress("正在上传分片 %d/%d...", partSeq+1, len(md5List))
-		uploadArg := upload.NewUploadArg(
-			precreateResult.UploadId,
-			remotePath,
-			chunkFiles[partSeq],
-			partSeq,
-		)
+	return uploadWithJournal(ctx, localFilePath, journal, opts)
+}
 
-		uploadResult, err := uploadChunkWithRetry(config.AccessToken, uploadArg, partSeq)
-		if err != nil {
-			return fmt.Errorf("上传分片 %d 失败: %v", partSeq, err)
+// 尝试秒传，返回是否已完成上传。服务端没有相同内容或目标路径已存在文件时返回 false，
+// 由调用方继续走普通上传流程
+func tryRapidUpload(ctx context.Context, localFilePath string, fileInfo os.FileInfo, remotePath string, digest *FileDigest, opts *UploadOptions) (bool, error) {
+	logger.Progress("正在尝试秒传...")
+	arg := upload.NewRapidUploadArg(remotePath, digest.Size, digest.ContentMD5, digest.SliceMD5)
+	arg.LocalMtime = fileInfo.ModTime().Unix()
+	if opts.Overwrite {
+		arg.Rtype = upload.RtypeOverwrite
+	}
+	var result upload.RapidUploadReturn
+	err := withToken(func(accessToken string) (err error) {
+		result, err = uploadClient.RapidUploadWithContext(ctx, accessToken, arg)
+		return err
+	})
+	switch {
+	case err == nil:
+		path := result.Path
+		if path == "" {
+			path = remotePath
 		}
-		logger.Debug("分片 %d 上传完成，MD5: %s", partSeq+1, uploadResult.Md5)
+		logger.Info("秒传成功！文件已上传到: %s", path)
+		fileIndex.setRemote(localFilePath, fileInfo, path, result.FsId)
+		return true, nil
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case isTokenError(err):
+		return false, fmt.Errorf("秒传失败: %w", err)
+	case errors.Is(err, errno.ErrRapidUploadMiss), errors.Is(err, errno.ErrFileExists):
+		logger.Debug("秒传未命中，使用分片上传: %v", err)
+	default:
+		logger.Warn("秒传失败，使用分片上传: %v", err)
+	}
+	return false, nil
+}
+
+// 根据上传日志上传剩余分片并创建文件，成功后删除上传日志
+func uploadWithJournal(ctx context.Context, localFilePath string, journal *UploadJournal, opts *UploadOptions) error {
+	// 打开源文件，各分片通过偏移量直接读取
+	file, err := os.Open(localFilePath)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+	opts.reportProgress(localFilePath, journal.completedSize())
+
+	// 2. Upload - 并发上传需要的分片（带重试）
+	err = uploadParts(ctx, file, journal.RemotePath, journal.UploadId, journal.pendingParts(), journal.Size, journal.chunkSize(), len(journal.BlockList), opts, journal.markCompleted)
+	if err != nil {
+		return err
 	}
 
 	// 3. Create - 创建文件
 	logger.Progress("正在合并文件...")
-	createArg := upload.NewCreateArg(precreateResult.UploadId, remotePath, fileSize, md5List)
-	createResult, err := upload.Create(config.AccessToken, createArg)
+	createArg := upload.NewCreateArg(journal.UploadId, journal.RemotePath, journal.Size, journal.BlockList)
+	createArg.Rtype = opts.rtype()
+	createArg.LocalMtime = journal.ModTime.Unix()
+	var createResult upload.CreateReturn
+	err = withToken(func(accessToken string) (err error) {
+		createResult, err = uploadClient.CreateWithContext(ctx, accessToken, createArg)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("创建文件失败: %v", err)
+		return fmt.Errorf("创建文件失败: %w", err)
 	}
 
 	if createResult.Errno != 0 {
 		return fmt.Errorf("创建文件失败，错误码: %d", createResult.Errno)
 	}
+	journal.remove()
+	if fileInfo, err := file.Stat(); err == nil {
+		fileIndex.setRemote(localFilePath, fileInfo, createResult.Path, createResult.FsId)
+	}
 
 	logger.Info("完成！文件已成功上传到: %s", createResult.Path)
 	return nil
 }
 
+// 并发上传分片，每个分片完成后调用 onPartDone，任一分片失败时取消其余分片并返回第一个错误
+func uploadParts(ctx context.Context, file *os.File, remotePath, uploadId string, partSeqs []int, fileSize uint64, chunkSize int64, totalParts int, opts *UploadOptions, onPartDone func(partSeq int, md5 string)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := opts.PartConcurrency
+	if workers > len(partSeqs) {
+		workers = len(partSeqs)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	partChan := make(chan int)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partSeq := range partChan {
+				logger.Progress("正在上传分片 %d/%d...", partSeq+1, totalParts)
+				offset := int64(partSeq) * chunkSize
+				partSize := int64(fileSize) - offset
+				if partSize > chunkSize {
+					partSize = chunkSize
+				}
+				uploadArg := upload.NewUploadPartArg(uploadId, remotePath, partSeq, file, offset, partSize)
+
+				uploadResult, err := uploadChunkWithRetry(ctx, uploadArg, partSeq, opts)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("上传分片 %d 失败: %w", partSeq, err)
+						cancel()
+					})
+					continue
+				}
+				logger.Debug("分片 %d 上传完成，MD5: %s", partSeq+1, uploadResult.Md5)
+				onPartDone(partSeq, uploadResult.Md5)
+				opts.reportProgress(file.Name(), partSize)
+			}
+		}()
+	}
+
+feed:
+	for _, partSeq := range partSeqs {
+		if partSeq < 0 || partSeq >= totalParts {
+			errOnce.Do(func() {
+				firstErr = fmt.Errorf("分片序号 %d 超出范围", partSeq)
+				cancel()
+			})
+			break
+		}
+		select {
+		case partChan <- partSeq:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(partChan)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
 func main() {
+	// 子命令（如 ls、tree）使用独立的参数解析
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
 	var localFilePath, localFolderPath, remoteFileName, authCode, refreshToken, excludePatterns, cacheDir string
 	var logFile, logLevel string
-	var initConfig, auth, refresh, keepStructure, quietMode bool
-	var authPort, maxConcurrent int
+	var initConfig, auth, refresh, keepStructure, quietMode, noRapid, syncMode, checksum, mirror, trash, dryRun, watch, rescan, device, paste bool
+	var maxDelete string
+	var authPort, maxConcurrent, partConcurrent, maxConnections, chunkSizeMB, watchDelay int
 
 	flag.StringVar(&localFilePath, "file", "", "要上传的本地文件路径")
 	flag.StringVar(&localFolderPath, "folder", "", "要上传的本地文件夹路径")
 	flag.StringVar(&remoteFileName, "name", "", "上传到网盘的文件名（可选，默认使用本地文件名）")
 	flag.StringVar(&excludePatterns, "exclude", "", "要排除的文件模式，用逗号分隔（如：*.tmp,*.log,.DS_Store）")
-	flag.StringVar(&cacheDir, "cache-dir", "", "指定分片缓存目录（可选，默认使用当前目录下的.chunks）")
+	flag.StringVar(&cacheDir, "cache-dir", "", "指定缓存目录，用于保存上传进度（可选，默认使用当前目录下的.chunks）")
 	flag.StringVar(&logFile, "log-file", "", "日志文件路径（可选，默认只输出到控制台）")
 	flag.StringVar(&logLevel, "log-level", "info", "日志级别 (debug,info,warn,error,fatal)")
 	flag.StringVar(&authCode, "code", "", "授权码（用于获取access_token）")
 	flag.StringVar(&refreshToken, "refresh", "", "刷新token")
 	flag.BoolVar(&initConfig, "init", false, "初始化配置文件")
 	flag.BoolVar(&auth, "auth", false, "启动授权流程")
+	flag.BoolVar(&device, "device", false, "与-auth一起使用，通过设备码在其他设备上完成授权（适用于没有浏览器的服务器）")
+	flag.BoolVar(&paste, "paste", false, "与-auth一起使用，不启动回调服务器，授权后粘贴浏览器跳转到的完整地址")
+	flag.StringVar(&configFlag, "config", "", "配置文件路径（默认依次查找 BDDISK_CONFIG 环境变量、用户配置目录下的 bddisk_uploader/config.json 和当前目录的 config.json）")
+	flag.StringVar(&activeProfile, "profile", "", "使用的账号配置（默认使用配置文件中的默认profile，见 profiles 子命令）")
 	flag.BoolVar(&refresh, "refresh-token", false, "使用refresh_token刷新access_token")
 	flag.BoolVar(&keepStructure, "keep-structure", true, "保持文件夹结构（默认启用）")
 	flag.BoolVar(&quietMode, "quiet", false, "静默模式（减少输出信息）")
+	flag.BoolVar(&noRapid, "no-rapid", false, "不尝试秒传，直接分片上传")
+	flag.BoolVar(&syncMode, "sync", false, "同步模式：只上传远程不存在或大小、修改时间不同的文件")
+	flag.BoolVar(&checksum, "checksum", false, "同步模式下大小相同但修改时间不同时比较MD5")
+	flag.BoolVar(&mirror, "mirror", false, "镜像模式：在同步的基础上删除远程目录中本地已不存在的文件")
+	flag.BoolVar(&trash, "trash", false, "镜像模式下将多余的远程文件移动到 app_path/.trash/<日期>/，而不是直接删除")
+	flag.StringVar(&maxDelete, "max-delete", DefaultMaxDelete, "镜像模式下单次最多删除的文件数，可以是数量或百分比（默认10%）")
+	flag.BoolVar(&dryRun, "dry-run", false, "只输出同步/镜像计划，不上传也不删除")
+	flag.BoolVar(&rescan, "rescan", false, "忽略上次未完成的任务队列，重新扫描文件夹")
+	flag.BoolVar(&watch, "watch", false, "监听模式：同步文件夹后持续运行，新增或修改的文件停止变化后自动上传")
+	flag.IntVar(&watchDelay, "watch-delay", DefaultWatchDelay, "监听模式下文件停止变化多少秒后上传（默认5）")
+	flag.IntVar(&chunkSizeMB, "chunk-size", 0, "分片大小，单位MB（可选，默认使用账号允许的最大分片：普通用户4，会员16，超级会员32）")
 	flag.IntVar(&authPort, "port", 8080, "授权回调服务器端口")
 	flag.IntVar(&maxConcurrent, "concurrent", 3, "最大并发上传数（默认3）")
+	flag.IntVar(&partConcurrent, "part-concurrent", 1, "单个文件同时上传的分片数（默认1）")
+	flag.IntVar(&maxConnections, "max-connections", 8, "所有文件同时上传的分片总数上限（默认8，0表示不限制）")
 	flag.Parse()
 
 	// 解析日志级别
@@ -393,11 +689,15 @@ func main() {
 
 	// 初始化配置文件
 	if initConfig {
+		if activeProfile != "" && activeProfile != DefaultProfile {
+			logger.Error("添加其他账号请使用: ./bddisk_uploader profiles add %s", activeProfile)
+			os.Exit(1)
+		}
 		if err := createDefaultConfig(); err != nil {
 			logger.Error("创建配置文件失败: %v", err)
 			os.Exit(1)
 		}
-		logger.Info("已创建配置文件 %s", ConfigFile)
+		logger.Info("已创建配置文件 %s", configFilePath())
 		logger.Info("请编辑配置文件中的以下信息:")
 		logger.Info("  - client_id: 您的App Key")
 		logger.Info("  - client_secret: 您的Secret Key")
@@ -414,19 +714,29 @@ func main() {
 			os.Exit(1)
 		}
 
-		tokenResp, err := startAuthServer(config.OAuth, authPort)
+		var tokenResp *TokenResponse
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		switch {
+		case device:
+			tokenResp, err = startDeviceAuth(ctx, config.OAuth)
+		case paste:
+			tokenResp, err = startPasteAuth(config.OAuth, os.Stdin)
+		default:
+			tokenResp, err = startAuthServer(ctx, config.OAuth, authPort)
+		}
+		stop()
 		if err != nil {
 			logger.Error("授权失败: %v", err)
 			os.Exit(1)
 		}
 
-		// 保存token到配置文件
-		if err := saveTokenToConfig(tokenResp); err != nil {
+		// 保存token到凭据存储
+		if err := saveToken(tokenResp); err != nil {
 			logger.Error("保存token失败: %v", err)
 			os.Exit(1)
 		}
 
-		logger.Info("授权成功！access_token已保存到配置文件")
+		logger.Info("授权成功！access_token已保存到%s", credentialStoreName(config))
 		return
 	}
 
@@ -444,12 +754,12 @@ func main() {
 			os.Exit(1)
 		}
 
-		if err := saveTokenToConfig(tokenResp); err != nil {
+		if err := saveToken(tokenResp); err != nil {
 			logger.Error("保存token失败: %v", err)
 			os.Exit(1)
 		}
 
-		logger.Info("access_token获取成功并已保存！")
+		logger.Info("access_token获取成功并已保存到%s", credentialStoreName(config))
 		return
 	}
 
@@ -466,17 +776,12 @@ func main() {
 			os.Exit(1)
 		}
 
-		tokenResp, err := refreshAccessToken(config.OAuth, config.RefreshToken)
-		if err != nil {
+		// 与上传、serve等进程一样在凭据锁内刷新，避免同一个refresh_token被使用两次
+		if err := newTokenSource(config).refresh(); err != nil {
 			logger.Error("刷新token失败: %v", err)
 			os.Exit(1)
 		}
 
-		if err := saveTokenToConfig(tokenResp); err != nil {
-			logger.Error("保存token失败: %v", err)
-			os.Exit(1)
-		}
-
 		logger.Info("access_token刷新成功！")
 		return
 	}
@@ -486,16 +791,74 @@ func main() {
 		fmt.Println("使用方法:")
 		fmt.Println("  初始化配置: ./bddisk_uploader -init")
 		fmt.Println("  授权登录: ./bddisk_uploader -auth")
+		fmt.Println("  粘贴回调地址授权: ./bddisk_uploader -auth -paste（本机无法接收回调时使用）")
+		fmt.Println("  设备码授权: ./bddisk_uploader -auth -device（在其他设备上输入用户码或扫码，适用于没有浏览器的服务器）")
 		fmt.Println("  手动授权: ./bddisk_uploader -code <授权码>")
 		fmt.Println("  刷新token: ./bddisk_uploader -refresh-token")
+		fmt.Println("  以上命令和子命令都可以加 -profile <名称> 使用其他账号，加 -config <路径> 指定配置文件")
+		fmt.Println("  配置文件默认依次查找 BDDISK_CONFIG、用户配置目录（如 ~/.config/bddisk_uploader/config.json）和当前目录的 config.json")
+		fmt.Println("  环境变量 BDDISK_ACCESS_TOKEN、BDDISK_REFRESH_TOKEN、BDDISK_EXPIRES_AT、BDDISK_APP_PATH、BDDISK_API_HOST、BDDISK_UPLOAD_HOST、")
+		fmt.Println("  BDDISK_CLIENT_ID、BDDISK_CLIENT_SECRET、BDDISK_REDIRECT_URI、BDDISK_SCOPE 覆盖配置文件中的对应字段，BDDISK_PROFILE 选择profile")
 		fmt.Println("  上传文件: ./bddisk_uploader -file <本地文件路径> [-name <远程文件名>]")
 		fmt.Println("  上传文件夹: ./bddisk_uploader -folder <本地文件夹路径> [选项]")
 		fmt.Println("")
+		fmt.Println("远程浏览（路径相对于app_path）:")
+		fmt.Println("  ./bddisk_uploader ls [--json] [远程目录]")
+		fmt.Println("  ./bddisk_uploader tree [--json] [-depth N] [远程目录]")
+		fmt.Println("  ./bddisk_uploader stat [--json] <远程路径>")
+		fmt.Println("  ./bddisk_uploader du [--json] [远程目录]")
+		fmt.Println("")
+		fmt.Println("下载（远程目录会完整镜像到本地，中断后重新运行即可续传）:")
+		fmt.Println("  ./bddisk_uploader download [-o 本地目录] [-connections 4] [-concurrent 3] [-no-verify] [-delete-mismatch] <远程路径>")
+		fmt.Println("")
+		fmt.Println("本地文件索引（缓存已计算的MD5，文件未变化时上传无需重新读取）:")
+		fmt.Println("  ./bddisk_uploader index show [--json] [本地路径]")
+		fmt.Println("  ./bddisk_uploader index rebuild [-chunk-size MB] [本地目录...]")
+		fmt.Println("  ./bddisk_uploader index prune")
+		fmt.Println("")
+		fmt.Println("多账号（每个profile有独立的OAuth应用、token和app_path，* 为默认profile）:")
+		fmt.Println("  ./bddisk_uploader profiles list [--json]")
+		fmt.Println("  ./bddisk_uploader profiles add [-client-id ID -client-secret SECRET] [-app-path 路径] <名称>")
+		fmt.Println("  ./bddisk_uploader profiles remove <名称>")
+		fmt.Println("  ./bddisk_uploader profiles default [名称]")
+		fmt.Println("")
+		fmt.Println("凭据（token和client_secret保存在配置文件旁权限为0600的 credentials.json 中，或由配置项 credential_helper 指定的外部程序保存）:")
+		fmt.Println("  ./bddisk_uploader credentials status|migrate")
+		fmt.Println("  BDDISK_PASSPHRASE=<口令> ./bddisk_uploader credentials encrypt|decrypt")
+		fmt.Println("")
+		fmt.Println("配置项（app_path、api_host、upload_host、credential_helper、oauth.client_id、oauth.client_secret、oauth.redirect_uri、oauth.scope、access_token、refresh_token、serve_token）:")
+		fmt.Println("  ./bddisk_uploader config show [--json] [-reveal]")
+		fmt.Println("  ./bddisk_uploader config get [-reveal] <配置项>")
+		fmt.Println("  ./bddisk_uploader config set <配置项> <值>")
+		fmt.Println("  ./bddisk_uploader config unset <配置项>")
+		fmt.Println("")
+		fmt.Println("故障排查（检查配置、token、缓存目录、授权回调端口和服务地址的连通性，有失败项时退出码为1）:")
+		fmt.Println("  ./bddisk_uploader doctor [--json] [-cache-dir 路径] [-port 8080] [-timeout 10s]")
+		fmt.Println("")
+		fmt.Println("上传服务（本机HTTP接口，POST /jobs 创建任务，GET /jobs[/<id>] 查询进度，POST /jobs/<id>/cancel|pause|resume）:")
+		fmt.Println("  ./bddisk_uploader serve [-listen 127.0.0.1:8765] [-jobs 2] [-concurrent 3] [-cache-dir 路径]")
+		fmt.Println("  请求需带 Authorization: Bearer <serve_token>，POST请求的Content-Type为application/json；未设置serve_token时启动时随机生成")
+		fmt.Println("")
 		fmt.Println("文件夹上传选项:")
 		fmt.Println("  -exclude <模式>        排除文件模式，逗号分隔")
 		fmt.Println("  -keep-structure       保持文件夹结构（默认启用）")
 		fmt.Println("  -concurrent <数量>     最大并发上传数（默认3）")
-		fmt.Println("  -cache-dir <路径>      指定分片缓存目录（默认使用当前目录下的.chunks）")
+		fmt.Println("  -sync                 同步模式：只上传新增或修改过的文件，修改过的文件覆盖远程文件")
+		fmt.Println("  -checksum             同步模式下修改时间不同但大小相同时比较MD5，相同则跳过")
+		fmt.Println("  -mirror               镜像模式：同步后删除远程目录中本地已不存在的文件（匹配-exclude的远程文件保留）")
+		fmt.Println("  -trash                镜像模式下将多余的远程文件移动到 app_path/.trash/<日期>/")
+		fmt.Println("  -max-delete <数量|%>   镜像模式下单次最多删除的文件数，超过时中止（默认10%）")
+		fmt.Println("  -dry-run              只输出同步/镜像计划，不做任何修改")
+		fmt.Println("  -rescan               忽略上次中断时保存的任务队列，重新扫描文件夹")
+		fmt.Println("  -watch                监听模式：先同步已有文件，之后持续上传新增或修改的文件，按 Ctrl-C 退出")
+		fmt.Println("  -watch-delay <秒>      监听模式下文件停止变化多少秒后上传（默认5）")
+		fmt.Println("")
+		fmt.Println("分片上传选项:")
+		fmt.Println("  -part-concurrent <数量> 单个文件同时上传的分片数（默认1）")
+		fmt.Println("  -max-connections <数量> 所有文件同时上传的分片总数上限（默认8）")
+		fmt.Println("  -no-rapid             不尝试秒传，直接分片上传")
+		fmt.Println("  -chunk-size <MB>      分片大小（默认使用账号允许的最大分片）")
+		fmt.Println("  -cache-dir <路径>      指定缓存目录，用于保存上传进度（默认使用当前目录下的.chunks）")
 		fmt.Println("")
 		fmt.Println("日志选项:")
 		fmt.Println("  -log-file <路径>       日志文件路径（可选，默认只输出到控制台）")
@@ -510,6 +873,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	if watch && localFolderPath == "" {
+		logger.Error("错误: -watch 只能与 -folder 一起使用")
+		os.Exit(1)
+	}
+	if watch && dryRun {
+		logger.Error("错误: -watch 不能与 -dry-run 一起使用")
+		os.Exit(1)
+	}
+	if watchDelay < 0 {
+		logger.Error("错误: -watch-delay 不能为负数")
+		os.Exit(1)
+	}
+
 	// 检查文件或文件夹是否存在
 	var targetPath string
 	var isFolder bool
@@ -546,27 +922,16 @@ func main() {
 		logger.Error("请先运行: ./bddisk_uploader -init 来创建配置文件")
 		os.Exit(1)
 	}
+	initSDKClients(config)
+	if profile := currentProfile(); profile != DefaultProfile {
+		logger.Info("使用账号配置: %s", profile)
+	}
 
-	// 检查token是否过期
-	if config.ExpiresAt != nil && time.Now().After(*config.ExpiresAt) {
-		logger.Warn("access_token已过期，尝试自动刷新...")
-		if config.RefreshToken != "" && config.OAuth != nil {
-			tokenResp, err := refreshAccessToken(config.OAuth, config.RefreshToken)
-			if err != nil {
-				logger.Error("自动刷新token失败: %v", err)
-				logger.Error("请重新授权: ./bddisk_uploader -auth")
-				os.Exit(1)
-			}
-			if err := saveTokenToConfig(tokenResp); err != nil {
-				logger.Error("保存新token失败: %v", err)
-				os.Exit(1)
-			}
-			config.AccessToken = tokenResp.AccessToken
-			logger.Info("access_token已自动刷新")
-		} else {
-			logger.Error("无法自动刷新token，请重新授权: ./bddisk_uploader -auth")
-			os.Exit(1)
-		}
+	// 检查token是否过期，即将过期时提前刷新
+	if _, err := tokens.token(); err != nil {
+		logger.Error("%v", err)
+		logger.Error("请重新授权: ./bddisk_uploader -auth%s", profileFlagHint())
+		os.Exit(1)
 	}
 
 	// 获取缓存目录
@@ -576,86 +941,122 @@ func main() {
 		os.Exit(1)
 	}
 	logger.Info("使用缓存目录: %s", actualCacheDir)
+	cleanupStaleChunks(actualCacheDir)
+	fileIndex = loadFileIndex(actualCacheDir)
+
+	// 收到 SIGINT/SIGTERM 时取消正在进行的上传，等待分片清理后再退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// 恢复默认信号处理，再次按下 Ctrl-C 将强制退出
+		stop()
+		logger.Warn("收到中断信号，正在停止上传...（再次按 Ctrl-C 强制退出）")
+	}()
 
 	// 上传文件或文件夹
+	uploadOpts := newUploadOptions(partConcurrent, maxConnections, !noRapid)
+
+	// 根据账号等级确定分片大小和单文件上限
+	limits, err := queryAccountLimits(ctx)
+	if err != nil {
+		if chunkSizeMB > 0 && chunkSizeMB*1024*1024 != ChunkSize {
+			logger.Error("%v，无法校验分片大小", err)
+			os.Exit(1)
+		}
+		logger.Warn("%v，使用默认分片大小 %s", err, formatFileSize(ChunkSize))
+	} else {
+		chunkSize, err := resolveChunkSize(limits, chunkSizeMB)
+		if err != nil {
+			logger.Error("分片大小无效: %v", err)
+			os.Exit(1)
+		}
+		uploadOpts.ChunkSize = chunkSize
+		uploadOpts.MaxFileSize = limits.MaxFileSize
+		uploadOpts.AccountName = limits.Name
+		logger.Info("账号类型: %s，分片大小: %s，单文件上限: %s", limits.Name, formatFileSize(chunkSize), formatFileSize(limits.MaxFileSize))
+	}
 	if isFolder {
 		// 上传文件夹
 		excludeList := parseExcludePatterns(excludePatterns)
 		logger.Info("开始上传文件夹: %s", targetPath)
-		if err := uploadFolderWithCacheDir(config, targetPath, excludeList, keepStructure, maxConcurrent, actualCacheDir); err != nil {
-			logger.Error("上传失败: %v", err)
+		if rescan {
+			removeUploadQueue(uploadQueuePath(actualCacheDir, targetPath, keepStructure))
+		}
+		var syncOpts *SyncOptions
+		if syncMode || mirror {
+			limit, err := parseDeleteLimit(maxDelete)
+			if err != nil {
+				logger.Error("-max-delete 参数无效: %v", err)
+				os.Exit(1)
+			}
+			syncOpts = &SyncOptions{
+				Checksum:  checksum,
+				DryRun:    dryRun,
+				Mirror:    mirror,
+				Trash:     trash,
+				MaxDelete: limit,
+				Exclude:   excludeList,
+			}
+			// 已修改的文件直接覆盖远程文件
+			uploadOpts.Overwrite = true
+		} else if dryRun {
+			logger.Error("-dry-run 需要与 -sync 或 -mirror 一起使用")
 			os.Exit(1)
 		}
+		if watch {
+			// 监听模式下修改过的文件同样覆盖远程文件，直到收到中断信号才退出
+			uploadOpts.Overwrite = true
+			err := watchFolderWithCacheDir(ctx, config, targetPath, excludeList, keepStructure, maxConcurrent, actualCacheDir, uploadOpts, syncOpts, time.Duration(watchDelay)*time.Second)
+			flushFileIndex()
+			if ctx.Err() == nil {
+				exitOnUploadError(ctx, err)
+			}
+			logger.Info("已停止监听")
+			return
+		}
+		if err := uploadFolderWithCacheDir(ctx, config, targetPath, excludeList, keepStructure, maxConcurrent, actualCacheDir, uploadOpts, syncOpts); err != nil {
+			exitOnUploadError(ctx, err)
+		}
+		flushFileIndex()
 		logger.Info("文件夹上传完成！")
 	} else {
 		// 上传单个文件
 		logger.Info("开始上传文件: %s -> %s", targetPath, remoteFileName)
-		if err := uploadFileWithCacheDir(config, targetPath, remoteFileName, actualCacheDir); err != nil {
-			logger.Error("上传失败: %v", err)
-			os.Exit(1)
+		if err := uploadFileWithCacheDir(ctx, config, targetPath, remoteFileName, actualCacheDir, uploadOpts); err != nil {
+			exitOnUploadError(ctx, err)
 		}
+		flushFileIndex()
 		logger.Info("上传成功！")
 	}
 }
 
-// 加载配置用于授权（不要求access_token存在）
-func loadConfigForAuth() (*Config, error) {
-	configData, err := os.ReadFile(ConfigFile)
-	if err != nil {
-		return nil, fmt.Errorf("读取配置文件失败: %v", err)
-	}
-
-	var config Config
-	if err := json.Unmarshal(configData, &config); err != nil {
-		return nil, fmt.Errorf("解析配置文件失败: %v", err)
-	}
-
-	if config.OAuth == nil {
-		return nil, fmt.Errorf("配置文件中缺少OAuth信息")
-	}
-
-	if config.OAuth.ClientID == "" || config.OAuth.ClientID == "your_app_key_here" {
-		return nil, fmt.Errorf("请先在配置文件中设置正确的client_id (App Key)")
+// 上传出错时退出，被信号中断时使用退出码130
+func exitOnUploadError(ctx context.Context, err error) {
+	flushFileIndex()
+	if ctx.Err() != nil {
+		logger.Warn("上传已中断: %v", err)
+		logger.Warn("上传进度已保存，重新运行相同的命令即可继续上传")
+		os.Exit(130)
 	}
-
-	if config.OAuth.ClientSecret == "" || config.OAuth.ClientSecret == "your_secret_key_here" {
-		return nil, fmt.Errorf("请先在配置文件中设置正确的client_secret (Secret Key)")
+	logger.Error("上传失败: %v", err)
+	if hint := errorHint(err); hint != "" {
+		logger.Error("提示: %s", hint)
 	}
-
-	if config.AppPath == "" {
-		config.AppPath = "/apps/baidu_netdisk_uploader/"
-	}
-
-	return &config, nil
+	os.Exit(1)
 }
 
-// 保存token到配置文件
-func saveTokenToConfig(tokenResp *TokenResponse) error {
-	// 读取现有配置
-	config, err := loadConfigForAuth()
+// 加载当前profile的配置用于授权（不要求access_token存在）
+func loadConfigForAuth() (*Config, error) {
+	config, err := loadProfileConfig()
 	if err != nil {
-		return err
-	}
-
-	// 更新token信息
-	config.AccessToken = tokenResp.AccessToken
-	if tokenResp.RefreshToken != "" {
-		config.RefreshToken = tokenResp.RefreshToken
-	}
-
-	// 计算过期时间
-	if tokenResp.ExpiresIn > 0 {
-		expiresAt := time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-		config.ExpiresAt = &expiresAt
+		return nil, err
 	}
 
-	// 保存到文件
-	configData, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		return fmt.Errorf("序列化配置失败: %v", err)
+	if err := validateConfig(config, false, true); err != nil {
+		return nil, err
 	}
-
-	return os.WriteFile(ConfigFile, configData, 0644)
+	return config, nil
 }
 
 // 文件信息结构
@@ -724,16 +1125,15 @@ func shouldExcludeFile(filePath string, excludePatterns []string) bool {
 	return false
 }
 
-// 收集文件夹中的所有文件
-func collectFiles(folderPath string, excludePatterns []string, keepStructure bool) ([]FileInfo, error) {
+// 收集文件夹中的所有文件，同时返回无法访问的文件和目录数
+func collectFiles(folderPath string, excludePatterns []string, keepStructure bool) ([]FileInfo, int, error) {
 	var files []FileInfo
-
-	// 获取文件夹名称，用于保持完整的目录结构
-	folderName := filepath.Base(folderPath)
+	unreadable := 0
 
 	err := filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			logger.Warn("警告: 访问文件失败 %s: %v", path, err)
+			unreadable++
 			return nil // 继续处理其他文件
 		}
 
@@ -748,47 +1148,55 @@ func collectFiles(folderPath string, excludePatterns []string, keepStructure boo
 			return nil
 		}
 
-		// 计算远程路径
-		var remotePath string
-		if keepStructure {
-			// 保持目录结构，包含最外层文件夹名
-			relPath, err := filepath.Rel(folderPath, path)
-			if err != nil {
-				return fmt.Errorf("计算相对路径失败: %v", err)
-			}
-			// 将文件夹名称作为根目录
-			remotePath = filepath.Join(folderName, relPath)
-			remotePath = strings.ReplaceAll(remotePath, "\\", "/")
-		} else {
-			// 平铺所有文件到文件夹根目录
-			remotePath = filepath.Join(folderName, info.Name())
-			remotePath = strings.ReplaceAll(remotePath, "\\", "/")
-		}
-
-		files = append(files, FileInfo{
-			LocalPath:  path,
-			RemotePath: remotePath,
-			Size:       info.Size(),
-			ModTime:    info.ModTime(),
-		})
+		fileInfo, err := newFolderFileInfo(folderPath, path, info, keepStructure)
+		if err != nil {
+			return err
+		}
+		files = append(files, fileInfo)
 
 		return nil
 	})
 
-	return files, err
+	return files, unreadable, err
 }
 
-// 上传单个文件（用于并发上传）- 支持缓存目录
-func uploadSingleFileWithCacheDir(config *Config, fileInfo FileInfo, stats *UploadStats, wg *sync.WaitGroup, semaphore chan struct{}, cacheDir string) {
-	defer wg.Done()
-	defer func() { <-semaphore }() // 释放信号量
+// 根据文件在文件夹中的位置计算远程路径
+func newFolderFileInfo(folderPath, path string, info os.FileInfo, keepStructure bool) (FileInfo, error) {
+	// 获取文件夹名称，用于保持完整的目录结构
+	folderName := filepath.Base(folderPath)
+
+	var remotePath string
+	if keepStructure {
+		// 保持目录结构，包含最外层文件夹名
+		relPath, err := filepath.Rel(folderPath, path)
+		if err != nil {
+			return FileInfo{}, fmt.Errorf("计算相对路径失败: %v", err)
+		}
+		// 将文件夹名称作为根目录
+		remotePath = filepath.Join(folderName, relPath)
+		remotePath = strings.ReplaceAll(remotePath, "\\", "/")
+	} else {
+		// 平铺所有文件到文件夹根目录
+		remotePath = filepath.Join(folderName, info.Name())
+		remotePath = strings.ReplaceAll(remotePath, "\\", "/")
+	}
+
+	return FileInfo{
+		LocalPath:  path,
+		RemotePath: remotePath,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+	}, nil
+}
 
+// 上传单个文件（用于并发上传）- 支持缓存目录
+func uploadSingleFileWithCacheDir(ctx context.Context, config *Config, fileInfo FileInfo, stats *UploadStats, cacheDir string, opts *UploadOptions) error {
 	fmt.Printf("[%d/%d] 上传: %s\n",
 		atomic.LoadInt64(&stats.UploadedFiles)+atomic.LoadInt64(&stats.FailedFiles)+1,
-		stats.TotalFiles,
+		atomic.LoadInt64(&stats.TotalFiles),
 		fileInfo.RemotePath)
 
-	err := uploadFileWithCacheDir(config, fileInfo.LocalPath, fileInfo.RemotePath, cacheDir)
+	err := uploadFileWithCacheDir(ctx, config, fileInfo.LocalPath, fileInfo.RemotePath, cacheDir, opts)
 	if err != nil {
 		atomic.AddInt64(&stats.FailedFiles, 1)
 		fmt.Printf("❌ 上传失败: %s - %v\n", fileInfo.RemotePath, err)
@@ -797,6 +1205,61 @@ func uploadSingleFileWithCacheDir(config *Config, fileInfo FileInfo, stats *Uplo
 		atomic.AddInt64(&stats.UploadedSize, fileInfo.Size)
 		fmt.Printf("✅ 上传成功: %s\n", fileInfo.RemotePath)
 	}
+	return err
+}
+
+// 并发上传池，文件夹上传和监听模式共用
+type uploadPool struct {
+	ctx       context.Context
+	config    *Config
+	cacheDir  string
+	opts      *UploadOptions
+	stats     *UploadStats
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+
+	// 可选，每个文件上传结束后调用
+	onDone func(fileInfo FileInfo, err error)
+}
+
+func newUploadPool(ctx context.Context, config *Config, maxConcurrent int, cacheDir string, opts *UploadOptions, stats *UploadStats) *uploadPool {
+	return &uploadPool{
+		ctx:       ctx,
+		config:    config,
+		cacheDir:  cacheDir,
+		opts:      opts,
+		stats:     stats,
+		semaphore: make(chan struct{}, maxConcurrent),
+	}
+}
+
+// 提交一个文件，并发数已满时等待空闲；ctx取消时不再提交并返回false
+func (p *uploadPool) submit(fileInfo FileInfo) bool {
+	select {
+	case p.semaphore <- struct{}{}: // 获取信号量
+	case <-p.ctx.Done():
+		return false
+	}
+	if p.ctx.Err() != nil {
+		<-p.semaphore
+		return false
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := uploadSingleFileWithCacheDir(p.ctx, p.config, fileInfo, p.stats, p.cacheDir, p.opts)
+		<-p.semaphore // 释放信号量
+		if p.onDone != nil {
+			p.onDone(fileInfo, err)
+		}
+	}()
+	return true
+}
+
+// 等待所有已提交的文件上传结束
+func (p *uploadPool) wait() {
+	p.wg.Wait()
 }
 
 // 格式化文件大小
@@ -824,11 +1287,25 @@ func formatDuration(d time.Duration) string {
 	}
 }
 
-// 上传文件夹 - 支持缓存目录
-func uploadFolderWithCacheDir(config *Config, folderPath string, excludePatterns []string, keepStructure bool, maxConcurrent int, cacheDir string) error {
+// 上传文件夹 - 支持缓存目录，ctx取消后不再启动新的上传
+func uploadFolderWithCacheDir(ctx context.Context, config *Config, folderPath string, excludePatterns []string, keepStructure bool, maxConcurrent int, cacheDir string, opts *UploadOptions, syncOpts *SyncOptions) error {
+	// 上次的任务队列还有未完成的文件时直接继续，无需重新扫描和对比
+	queuePath := uploadQueuePath(cacheDir, folderPath, keepStructure)
+	queueOptions := uploadQueueOptions(excludePatterns, syncOpts)
+	if syncOpts == nil || !syncOpts.DryRun {
+		if queue := loadUploadQueue(queuePath, queueOptions); queue != nil {
+			files := queue.pendingFiles()
+			logger.Info("继续上次未完成的文件夹上传，剩余 %d 个文件（使用 -rescan 重新扫描文件夹）", len(files))
+			if syncOpts != nil && syncOpts.Mirror {
+				logger.Warn("本次不清理远程多余的文件，上传完成后重新运行即可清理")
+			}
+			return uploadFileList(ctx, config, files, maxConcurrent, cacheDir, opts, queue)
+		}
+	}
+
 	// 收集所有需要上传的文件
 	logger.Info("正在扫描文件...")
-	files, err := collectFiles(folderPath, excludePatterns, keepStructure)
+	files, unreadable, err := collectFiles(folderPath, excludePatterns, keepStructure)
 	if err != nil {
 		return fmt.Errorf("收集文件失败: %v", err)
 	}
@@ -838,6 +1315,49 @@ func uploadFolderWithCacheDir(config *Config, folderPath string, excludePatterns
 		return nil
 	}
 
+	if syncOpts == nil {
+		return uploadFileList(ctx, config, files, maxConcurrent, cacheDir, opts, newFolderQueue(queuePath, queueOptions, files))
+	}
+
+	// 同步模式下只上传新增或修改过的文件
+	plan, err := buildSyncPlan(ctx, config, folderPath, files, unreadable, syncOpts)
+	if err != nil {
+		return fmt.Errorf("对比远程文件失败: %w", err)
+	}
+	if syncOpts.DryRun {
+		printSyncPlan(config, plan, syncOpts)
+		return nil
+	}
+
+	if uploads := plan.Uploads(); len(uploads) > 0 {
+		if err := uploadFileList(ctx, config, uploads, maxConcurrent, cacheDir, opts, newFolderQueue(queuePath, queueOptions, uploads)); err != nil {
+			if len(plan.Deletes) > 0 {
+				logger.Warn("有文件未上传成功，跳过清理远程多余的文件")
+			}
+			return err
+		}
+	} else {
+		fmt.Println("所有文件均未变化，无需上传")
+	}
+
+	// 全部上传成功后再清理远程多余的文件
+	return applyMirrorDeletes(ctx, config, plan, syncOpts)
+}
+
+// 创建文件夹上传的任务队列，失败时只输出警告
+func newFolderQueue(path, options string, files []FileInfo) *UploadQueue {
+	queue, err := createUploadQueue(path, options, files)
+	if err != nil {
+		logger.Warn("创建任务队列失败，本次上传中断后需要重新扫描: %v", err)
+		return nil
+	}
+	return queue
+}
+
+// 并发上传文件列表并输出进度和统计，queue 不为nil时记录每个文件的上传状态
+func uploadFileList(ctx context.Context, config *Config, files []FileInfo, maxConcurrent int, cacheDir string, opts *UploadOptions, queue *UploadQueue) error {
+	defer queue.close()
+
 	// 计算总大小
 	var totalSize int64
 	for _, file := range files {
@@ -854,9 +1374,18 @@ func uploadFolderWithCacheDir(config *Config, folderPath string, excludePatterns
 	fmt.Printf("发现 %d 个文件，总大小: %s\n", len(files), formatFileSize(totalSize))
 	fmt.Printf("开始并发上传 (最大并发数: %d)...\n\n", maxConcurrent)
 
-	// 创建信号量控制并发数
-	semaphore := make(chan struct{}, maxConcurrent)
-	var wg sync.WaitGroup
+	// 上传池控制并发数
+	pool := newUploadPool(ctx, config, maxConcurrent, cacheDir, opts, stats)
+	pool.onDone = func(fileInfo FileInfo, err error) {
+		switch {
+		case err == nil:
+			queue.setState(fileInfo.LocalPath, TaskDone, nil)
+		case ctx.Err() != nil:
+			queue.setState(fileInfo.LocalPath, TaskPending, nil)
+		default:
+			queue.setState(fileInfo.LocalPath, TaskFailed, err)
+		}
+	}
 
 	// 启动进度监控
 	done := make(chan bool)
@@ -884,14 +1413,18 @@ func uploadFolderWithCacheDir(config *Config, folderPath string, excludePatterns
 	}()
 
 	// 并发上传文件
-	for _, file := range files {
-		semaphore <- struct{}{} // 获取信号量
-		wg.Add(1)
-		go uploadSingleFileWithCacheDir(config, file, stats, &wg, semaphore, cacheDir)
+	skipped := 0
+	for i, file := range files {
+		queue.setState(file.LocalPath, TaskRunning, nil)
+		if !pool.submit(file) {
+			queue.setState(file.LocalPath, TaskPending, nil)
+			skipped = len(files) - i
+			break
+		}
 	}
 
 	// 等待所有上传完成
-	wg.Wait()
+	pool.wait()
 	done <- true
 
 	// 显示最终统计
@@ -912,6 +1445,11 @@ func uploadFolderWithCacheDir(config *Config, folderPath string, excludePatterns
 		fmt.Printf("平均速度: %s/s\n", formatFileSize(int64(avgSpeed)))
 	}
 
+	if ctx.Err() != nil {
+		fmt.Printf("未开始上传: %d\n", skipped)
+		return fmt.Errorf("上传被中断，%d 个文件失败，%d 个文件未开始: %w", failed, skipped, ctx.Err())
+	}
+
 	if failed > 0 {
 		return fmt.Errorf("有 %d 个文件上传失败", failed)
 	}
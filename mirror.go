@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"bddisk_uploader/logger"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/filemanager"
+)
+
+const (
+	TrashDirName     = ".trash" // 回收目录，位于app_path下
+	FileManagerBatch = 100      // filemanager接口单次处理的文件数
+	DefaultMaxDelete = "10%"
+	trashDateLayout  = "2006-01-02"
+)
+
+// 文件管理接口使用的SDK客户端，加载配置后重新创建
+var filemanagerClient = filemanager.NewClient()
+
+// 镜像模式下需要删除的远程文件或目录
+type MirrorDelete struct {
+	Path  string
+	IsDir bool
+	Files int   // 删除的文件数，目录为其中包含的文件数
+	Size  int64 // 删除的文件总大小
+}
+
+// 需要删除的文件总数
+func (p *SyncPlan) DeleteFiles() int {
+	n := 0
+	for _, d := range p.Deletes {
+		n += d.Files
+	}
+	return n
+}
+
+// 单次最多删除的文件数，可以是数量（如 100）或占远程文件总数的百分比（如 10%）
+type DeleteLimit struct {
+	Count   int
+	Percent float64 // 大于0时按百分比限制
+}
+
+func parseDeleteLimit(s string) (DeleteLimit, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return DeleteLimit{}, fmt.Errorf("无效的百分比: %s", s)
+		}
+		return DeleteLimit{Percent: percent}, nil
+	}
+	count, err := strconv.Atoi(s)
+	if err != nil || count < 0 {
+		return DeleteLimit{}, fmt.Errorf("无效的数量: %s", s)
+	}
+	return DeleteLimit{Count: count}, nil
+}
+
+// 是否允许从total个远程文件中删除n个
+func (l DeleteLimit) Allows(n, total int) bool {
+	if n == 0 {
+		return true
+	}
+	if l.Percent > 0 {
+		return float64(n) <= float64(total)*l.Percent/100
+	}
+	return n <= l.Count
+}
+
+func (l DeleteLimit) String() string {
+	if l.Percent > 0 {
+		return strconv.FormatFloat(l.Percent, 'f', -1, 64) + "%"
+	}
+	return strconv.Itoa(l.Count)
+}
+
+// 远程路径中任意一级匹配排除模式时不删除
+func remoteExcluded(rel string, excludePatterns []string) bool {
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		if shouldExcludeFile(strings.Join(parts[:i+1], "/"), excludePatterns) {
+			return true
+		}
+	}
+	return false
+}
+
+// 找出远程目录中本地已不存在的文件；整个目录都多余时只删除该目录
+func planMirrorDeletes(config *Config, remoteDir string, files []FileInfo, remote map[string]file.FileEntry, excludePatterns []string) []MirrorDelete {
+	expected := make(map[string]bool, len(files))
+	keepDirs := make(map[string]bool)
+	keepAncestors := func(p string) {
+		for dir := path.Dir(p); strings.HasPrefix(dir, remoteDir+"/"); dir = path.Dir(dir) {
+			keepDirs[dir] = true
+		}
+	}
+	for _, f := range files {
+		p := resolveRemotePath(config.AppPath, f.RemotePath)
+		expected[p] = true
+		keepAncestors(p)
+	}
+
+	paths := make([]string, 0, len(remote))
+	for p := range remote {
+		if !strings.HasPrefix(p, remoteDir+"/") {
+			continue
+		}
+		if remoteExcluded(strings.TrimPrefix(p, remoteDir+"/"), excludePatterns) {
+			keepAncestors(p)
+			continue
+		}
+		paths = append(paths, p)
+	}
+	// 按路径排序，保证目录先于其中的文件出现
+	sort.Strings(paths)
+
+	var deletes []MirrorDelete
+	deletedDirs := make(map[string]int) // 目录路径 -> 在deletes中的下标
+	for _, p := range paths {
+		e := remote[p]
+		if expected[p] || (e.IsDir() && keepDirs[p]) {
+			continue
+		}
+
+		// 已删除目录中的文件计入该目录
+		parent := -1
+		for dir := path.Dir(p); strings.HasPrefix(dir, remoteDir+"/"); dir = path.Dir(dir) {
+			if i, ok := deletedDirs[dir]; ok {
+				parent = i
+				break
+			}
+		}
+		if parent >= 0 {
+			if !e.IsDir() {
+				deletes[parent].Files++
+				deletes[parent].Size += int64(e.Size)
+			}
+			continue
+		}
+
+		d := MirrorDelete{Path: p, IsDir: e.IsDir()}
+		if d.IsDir {
+			deletedDirs[p] = len(deletes)
+		} else {
+			d.Files = 1
+			d.Size = int64(e.Size)
+		}
+		deletes = append(deletes, d)
+	}
+	return deletes
+}
+
+// 创建回收目录，已存在时忽略
+func ensureRemoteDir(ctx context.Context, dir string) error {
+	err := withToken(func(accessToken string) error {
+		_, err := fileClient.CreateDirWithContext(ctx, accessToken, file.NewCreateDirArg(dir))
+		return err
+	})
+	if err != nil && !errors.Is(err, errno.ErrFileExists) {
+		return fmt.Errorf("创建远程目录 %s 失败: %w", dir, err)
+	}
+	return nil
+}
+
+// 统计filemanager返回的单个文件失败
+func countManageFailures(ret filemanager.ManageReturn) int {
+	failed := 0
+	for _, info := range ret.Info {
+		if info.Errno != 0 {
+			failed++
+			logger.Error("处理远程文件失败: %s (%s)", info.Path, errno.Message(info.Errno))
+		}
+	}
+	return failed
+}
+
+// 删除远程多余的文件，或将其移动到 app_path/.trash/<日期>/ 下并保留原有目录结构
+func applyMirrorDeletes(ctx context.Context, config *Config, plan *SyncPlan, opts *SyncOptions) error {
+	if len(plan.Deletes) == 0 {
+		return nil
+	}
+
+	appRoot := resolveRemotePath(config.AppPath, "")
+	trashRoot := path.Join(appRoot, TrashDirName, time.Now().Format(trashDateLayout))
+	if opts.Trash {
+		logger.Info("正在将 %d 个远程文件移动到回收目录 %s ...", plan.DeleteFiles(), trashRoot)
+	} else {
+		logger.Info("正在删除 %d 个远程文件...", plan.DeleteFiles())
+	}
+
+	failed := 0
+	createdDirs := make(map[string]bool)
+	for start := 0; start < len(plan.Deletes); start += FileManagerBatch {
+		end := start + FileManagerBatch
+		if end > len(plan.Deletes) {
+			end = len(plan.Deletes)
+		}
+		batch := plan.Deletes[start:end]
+
+		var ret filemanager.ManageReturn
+		var err error
+		if opts.Trash {
+			items := make([]filemanager.CopyItem, 0, len(batch))
+			for _, d := range batch {
+				dest := path.Join(trashRoot, path.Dir(strings.TrimPrefix(d.Path, appRoot+"/")))
+				if !createdDirs[dest] {
+					if err := ensureRemoteDir(ctx, dest); err != nil {
+						return err
+					}
+					createdDirs[dest] = true
+				}
+				items = append(items, filemanager.CopyItem{Path: d.Path, Dest: dest, Newname: path.Base(d.Path)})
+			}
+			err = withToken(func(accessToken string) (err error) {
+				ret, err = filemanagerClient.MoveWithContext(ctx, accessToken, filemanager.NewMoveArg(items, filemanager.AsyncAdaptive, filemanager.OndupNewCopy))
+				return err
+			})
+		} else {
+			paths := make([]string, 0, len(batch))
+			for _, d := range batch {
+				paths = append(paths, d.Path)
+			}
+			err = withToken(func(accessToken string) (err error) {
+				ret, err = filemanagerClient.DeleteWithContext(ctx, accessToken, filemanager.NewDeleteArg(paths, filemanager.AsyncAdaptive))
+				return err
+			})
+		}
+
+		batchFailed := countManageFailures(ret)
+		if err != nil && batchFailed == 0 {
+			return fmt.Errorf("清理远程文件失败: %w", err)
+		}
+		failed += batchFailed
+		if ret.TaskId.String() != "" && ret.TaskId.String() != "0" {
+			logger.Info("服务端正在异步处理，任务ID: %s", ret.TaskId)
+		}
+		for _, d := range batch {
+			logger.Debug("已清理: %s", d.Path)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("有 %d 个远程文件清理失败", failed)
+	}
+	if opts.Trash {
+		fmt.Printf("已将 %d 个远程多余的文件移动到 %s\n", plan.DeleteFiles(), trashRoot)
+	} else {
+		fmt.Printf("已删除 %d 个远程多余的文件\n", plan.DeleteFiles())
+	}
+	return nil
+}
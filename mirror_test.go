@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+)
+
+func TestPlanMirrorDeletes(t *testing.T) {
+	config := &Config{AppPath: "/apps/test"}
+	files := []FileInfo{
+		{RemotePath: "docs/keep.txt"},
+		{RemotePath: "docs/sub/keep.txt"},
+	}
+	remote := map[string]file.FileEntry{
+		"/apps/test/docs/keep.txt":       {Size: 1},
+		"/apps/test/docs/extra.txt":      {Size: 2},
+		"/apps/test/docs/sub":            {Isdir: 1},
+		"/apps/test/docs/sub/keep.txt":   {Size: 3},
+		"/apps/test/docs/sub/old.txt":    {Size: 4},
+		"/apps/test/docs/gone":           {Isdir: 1},
+		"/apps/test/docs/gone/a.txt":     {Size: 5},
+		"/apps/test/docs/gone/deep":      {Isdir: 1},
+		"/apps/test/docs/gone/deep/b":    {Size: 6},
+		"/apps/test/docs/cache/x.tmp":    {Size: 7},
+		"/apps/test/docs/cache":          {Isdir: 1},
+		"/apps/test/docs/notes.tmp":      {Size: 8},
+		"/apps/test/other/unrelated.txt": {Size: 9},
+	}
+
+	got := planMirrorDeletes(config, "/apps/test/docs", files, remote, []string{"*.tmp"})
+	want := []MirrorDelete{
+		{Path: "/apps/test/docs/extra.txt", Files: 1, Size: 2},
+		{Path: "/apps/test/docs/gone", IsDir: true, Files: 2, Size: 11},
+		{Path: "/apps/test/docs/sub/old.txt", Files: 1, Size: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("planMirrorDeletes =\n%+v\nwant\n%+v", got, want)
+	}
+	plan := &SyncPlan{Deletes: got}
+	if n := plan.DeleteFiles(); n != 4 {
+		t.Errorf("DeleteFiles = %d, want 4", n)
+	}
+}
+
+func TestDeleteLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit    string
+		n, total int
+		allows   bool
+	}{
+		{"10%", 1, 10, true},
+		{"10%", 2, 10, false},
+		{"10%", 0, 0, true},
+		{"3", 3, 100, true},
+		{"3", 4, 100, false},
+		{"0", 1, 100, false},
+	} {
+		limit, err := parseDeleteLimit(tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := limit.Allows(tc.n, tc.total); got != tc.allows {
+			t.Errorf("%s.Allows(%d, %d) = %v", tc.limit, tc.n, tc.total, got)
+		}
+	}
+	for _, s := range []string{"", "abc", "-1", "0%", "101%"} {
+		if _, err := parseDeleteLimit(s); err == nil {
+			t.Errorf("parseDeleteLimit(%q) should fail", s)
+		}
+	}
+}
+
+func TestCollectFilesUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	dir := filepath.Join(t.TempDir(), "docs")
+	locked := filepath.Join(dir, "locked")
+	if err := os.MkdirAll(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(locked, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	files, unreadable, err := collectFiles(dir, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].RemotePath != "docs/a.txt" {
+		t.Errorf("files = %+v", files)
+	}
+	if unreadable != 1 {
+		t.Errorf("unreadable = %d, want 1", unreadable)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"bddisk_uploader/logger"
+)
+
+// 配置文件顶层字段对应的profile名称
+const DefaultProfile = "default"
+
+// -profile 参数指定的profile，为空时使用配置文件中的默认profile
+var activeProfile string
+
+// 配置文件的完整内容：顶层字段为 default profile（兼容只有一个账号的旧配置），
+// 其余账号保存在 profiles 中，每个profile有独立的OAuth应用、token和app_path
+type configFileData struct {
+	Version int `json:"version,omitempty"`
+	Config
+	DefaultProfile string             `json:"default_profile,omitempty"`
+	Profiles       map[string]*Config `json:"profiles,omitempty"`
+}
+
+// 读取配置文件，旧版本的配置文件升级后写回，原文件备份为 <文件>.v<版本>.bak；
+// 文件中仍有token或client_secret时只在内存中升级，等移到凭据存储时再写回
+func readConfigFile() (*configFileData, error) {
+	path := configFilePath()
+	configData, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("未找到配置文件（已查找: %s）: %w", strings.Join(configSearchPaths(), ", "), err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	migrated, version, err := migrateConfig(configData)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+	}
+	var data configFileData
+	if err := json.Unmarshal(migrated, &data); err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, jsonError(migrated, err))
+	}
+	if version != configVersion && data.hasSecrets() {
+		logger.Debug("配置文件 %s 中仍有token或client_secret，暂不写回升级后的配置", path)
+	} else if version != configVersion {
+		backup := fmt.Sprintf("%s.v%d.bak", path, version)
+		if err := writeFileAtomic(backup, configData, 0600); err != nil {
+			logger.Warn("配置文件已升级到版本 %d，但备份原文件失败，本次不写回: %v", configVersion, err)
+		} else if err := writeConfigFile(&data); err != nil {
+			logger.Warn("配置文件已升级到版本 %d，但写回失败: %v", configVersion, err)
+		} else {
+			logger.Info("配置文件已从版本 %d 升级到版本 %d，原文件备份为 %s", version, configVersion, backup)
+		}
+	}
+	return &data, nil
+}
+
+// 保存配置文件，保留原文件的权限；文件中有token或client_secret时只允许所有者读写
+func writeConfigFile(data *configFileData) error {
+	data.Version = configVersion
+	configData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化配置失败: %v", err)
+	}
+	path := configFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建配置目录失败: %v", err)
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	if data.hasSecrets() {
+		perm &= 0600
+	}
+	return writeFileAtomic(path, configData, perm)
+}
+
+// 是否有profile在配置文件中保存了token或client_secret（旧版本的配置文件）
+func (d *configFileData) hasSecrets() bool {
+	configs := []*Config{&d.Config}
+	for _, config := range d.Profiles {
+		configs = append(configs, config)
+	}
+	for _, c := range configs {
+		if c == nil {
+			continue
+		}
+		if c.AccessToken != "" && c.AccessToken != "your_access_token_here" || c.RefreshToken != "" || c.ServeToken != "" ||
+			c.OAuth != nil && realClientSecret(c.OAuth.ClientSecret) {
+			return true
+		}
+	}
+	return false
+}
+
+// 当前使用的profile：-profile 参数或 BDDISK_PROFILE 环境变量指定的，否则为配置文件中的默认profile
+func currentProfile() string {
+	if activeProfile == "" {
+		activeProfile = os.Getenv("BDDISK_PROFILE")
+	}
+	if activeProfile == "" {
+		activeProfile = DefaultProfile
+		if data, err := readConfigFile(); err == nil && data.DefaultProfile != "" {
+			activeProfile = data.DefaultProfile
+		}
+	}
+	return activeProfile
+}
+
+// 返回指定profile的配置，修改返回值会直接修改data
+func (d *configFileData) profile(name string) (*Config, error) {
+	if name == DefaultProfile {
+		return &d.Config, nil
+	}
+	if config, ok := d.Profiles[name]; ok && config != nil {
+		return config, nil
+	}
+	return nil, fmt.Errorf("配置文件中没有名为 %s 的profile（可用: %s）", name, strings.Join(d.profileNames(), ", "))
+}
+
+// 按名称排序的所有profile，顶层字段为空时不包含default
+func (d *configFileData) profileNames() []string {
+	var names []string
+	if d.AccessToken != "" || d.OAuth != nil {
+		names = append(names, DefaultProfile)
+	}
+	for name := range d.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 读取当前profile的配置并使用环境变量覆盖；
+// 没有配置文件时，只要设置了环境变量也可以运行
+func loadProfileConfig() (*Config, error) {
+	data, err := readConfigFile()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) || !hasConfigEnv() {
+			return nil, err
+		}
+		data = &configFileData{}
+	}
+	profile := currentProfile()
+	config, err := data.profile(profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := loadCredentials(profile, config); err != nil {
+		return nil, err
+	}
+	if err := applyConfigEnv(config); err != nil {
+		return nil, err
+	}
+	if config.AppPath == "" {
+		config.AppPath = "/apps/baidu_netdisk_uploader/"
+	}
+	return config, nil
+}
+
+// profile名称只允许字母、数字、-、_和.
+func validProfileName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// 提示信息中需要附加的 -profile 参数，使用默认profile时为空
+func profileFlagHint() string {
+	if profile := currentProfile(); profile != DefaultProfile {
+		return " -profile " + profile
+	}
+	return ""
+}
+
+// 子命令中的 -config 和 -profile 参数
+func addConfigFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configFlag, "config", "", "配置文件路径（默认依次查找 BDDISK_CONFIG、用户配置目录和当前目录）")
+	fs.StringVar(&activeProfile, "profile", "", "使用的账号配置（默认使用配置文件中的默认profile）")
+}
+
+// profiles list|add|remove|default
+func runProfiles(args []string) int {
+	if err := logger.InitWithConsole(logger.INFO, os.Stderr, "", false); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	usage := fmt.Errorf("用法: ./bddisk_uploader profiles list|add|remove|default [参数]")
+	if len(args) == 0 {
+		return commandFailed(context.Background(), usage)
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("profiles "+action, flag.ExitOnError)
+	fs.StringVar(&configFlag, "config", "", "配置文件路径（默认依次查找 BDDISK_CONFIG、用户配置目录和当前目录）")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出（list）")
+	clientID := fs.String("client-id", "", "OAuth应用的App Key（add，默认沿用default profile的应用）")
+	clientSecret := fs.String("client-secret", "", "OAuth应用的Secret Key（add）")
+	redirectURI := fs.String("redirect-uri", "", "授权回调地址（add）")
+	appPath := fs.String("app-path", "/apps/baidu_netdisk_uploader/", "上传路径前缀（add）")
+	if err := fs.Parse(args[1:]); err != nil {
+		return commandFailed(context.Background(), err)
+	}
+
+	data, err := readConfigFile()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) || action != "add" {
+			return commandFailed(context.Background(), err)
+		}
+		data = &configFileData{}
+	}
+
+	switch action {
+	case "list":
+		return listProfiles(data, *jsonOutput)
+
+	case "add":
+		if fs.NArg() != 1 || !validProfileName(fs.Arg(0)) {
+			return commandFailed(context.Background(), fmt.Errorf("用法: ./bddisk_uploader profiles add [-client-id ID -client-secret SECRET] [-app-path 路径] <名称>（名称只能包含字母、数字、-、_和.）"))
+		}
+		name := fs.Arg(0)
+		if _, err := data.profile(name); err == nil {
+			return commandFailed(context.Background(), fmt.Errorf("profile %s 已存在", name))
+		}
+		oauth := &OAuthConfig{ClientID: "your_app_key_here", ClientSecret: "your_secret_key_here", RedirectURI: DefaultRedirectURI, Scope: DefaultScope}
+		if data.OAuth != nil {
+			// 同一个应用可以授权多个账号
+			copied := *data.OAuth
+			oauth = &copied
+		}
+		if *clientID != "" {
+			oauth.ClientID = *clientID
+			oauth.ClientSecret = *clientSecret
+		} else if data.OAuth != nil && !realClientSecret(oauth.ClientSecret) {
+			cred, err := credentialStoreFor(&data.Config).get(DefaultProfile)
+			if err != nil {
+				return commandFailed(context.Background(), fmt.Errorf("读取default profile的client_secret失败: %v", err))
+			}
+			if cred != nil {
+				oauth.ClientSecret = cred.ClientSecret
+			}
+		}
+		if *redirectURI != "" {
+			oauth.RedirectURI = *redirectURI
+		}
+		// 服务地址和凭据存储各账号相同，沿用default profile的设置
+		config := &Config{AppPath: *appPath, OAuth: oauth, APIHost: data.APIHost, UploadHost: data.UploadHost, CredentialHelper: data.CredentialHelper}
+		// client_secret保存到凭据存储，不写入配置文件
+		if secret := oauth.ClientSecret; realClientSecret(secret) {
+			oauth.ClientSecret = ""
+			err := credentialStoreFor(config).update(name, func(cred *Credentials) error {
+				cred.ClientSecret = secret
+				return nil
+			})
+			if err != nil {
+				return commandFailed(context.Background(), err)
+			}
+		}
+		if data.Profiles == nil {
+			data.Profiles = make(map[string]*Config)
+		}
+		data.Profiles[name] = config
+		if err := writeConfigFile(data); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		logger.Info("已添加profile %s，请运行: ./bddisk_uploader -auth -profile %s 进行授权", name, name)
+		return 0
+
+	case "remove":
+		if fs.NArg() != 1 {
+			return commandFailed(context.Background(), fmt.Errorf("用法: ./bddisk_uploader profiles remove <名称>"))
+		}
+		name := fs.Arg(0)
+		if name == DefaultProfile {
+			return commandFailed(context.Background(), fmt.Errorf("default profile保存在配置文件顶层，不能删除"))
+		}
+		if _, ok := data.Profiles[name]; !ok {
+			return commandFailed(context.Background(), fmt.Errorf("profile %s 不存在", name))
+		}
+		if err := credentialStoreFor(data.Profiles[name]).erase(name); err != nil {
+			logger.Warn("删除profile %s 的凭据失败: %v", name, err)
+		}
+		delete(data.Profiles, name)
+		if data.DefaultProfile == name {
+			data.DefaultProfile = ""
+			logger.Warn("已删除的profile是默认profile，默认profile恢复为 %s", DefaultProfile)
+		}
+		if err := writeConfigFile(data); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		logger.Info("已删除profile %s", name)
+		return 0
+
+	case "default":
+		if fs.NArg() == 0 {
+			name := data.DefaultProfile
+			if name == "" {
+				name = DefaultProfile
+			}
+			fmt.Println(name)
+			return 0
+		}
+		name := fs.Arg(0)
+		if _, err := data.profile(name); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		data.DefaultProfile = name
+		if name == DefaultProfile {
+			data.DefaultProfile = ""
+		}
+		if err := writeConfigFile(data); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		logger.Info("默认profile已设置为 %s", name)
+		return 0
+	}
+	return commandFailed(context.Background(), usage)
+}
+
+// profile信息，用于--json输出
+type ProfileInfo struct {
+	Name       string     `json:"name"`
+	Default    bool       `json:"default"`
+	AppPath    string     `json:"app_path"`
+	ClientID   string     `json:"client_id,omitempty"`
+	Authorized bool       `json:"authorized"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+func listProfiles(data *configFileData, jsonOutput bool) int {
+	defaultName := data.DefaultProfile
+	if defaultName == "" {
+		defaultName = DefaultProfile
+	}
+	var infos []ProfileInfo
+	for _, name := range data.profileNames() {
+		stored, _ := data.profile(name)
+		config := *stored
+		if err := loadCredentials(name, &config); err != nil {
+			logger.Warn("profile %s: %v", name, err)
+		}
+		info := ProfileInfo{
+			Name:       name,
+			Default:    name == defaultName,
+			AppPath:    config.AppPath,
+			Authorized: config.AccessToken != "" && config.AccessToken != "your_access_token_here",
+			ExpiresAt:  config.ExpiresAt,
+		}
+		if config.OAuth != nil {
+			info.ClientID = config.OAuth.ClientID
+		}
+		infos = append(infos, info)
+	}
+
+	if jsonOutput {
+		if err := printJSON(infos); err != nil {
+			return commandFailed(context.Background(), err)
+		}
+		return 0
+	}
+	for _, info := range infos {
+		mark := " "
+		if info.Default {
+			mark = "*"
+		}
+		state := "未授权"
+		switch {
+		case info.Authorized && info.ExpiresAt != nil && time.Now().After(*info.ExpiresAt):
+			state = "已过期"
+		case info.Authorized && info.ExpiresAt != nil:
+			state = "有效期至 " + info.ExpiresAt.Local().Format("2006-01-02 15:04")
+		case info.Authorized:
+			state = "已授权"
+		}
+		fmt.Printf("%s %-16s %-40s %s\n", mark, info.Name, info.AppPath, state)
+	}
+	return 0
+}
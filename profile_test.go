@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// 使用临时目录中的配置文件，测试结束后恢复
+func useTestConfig(t *testing.T, content string, perm os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		t.Fatal(err)
+	}
+	old := configFlag
+	configFlag = path
+	t.Cleanup(func() { configFlag = old })
+	return path
+}
+
+func fileMode(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestWriteConfigFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+	path := useTestConfig(t, `{"version":1,"app_path":"/apps/test/"}`, 0640)
+	data, err := readConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.AppPath = "/apps/other/"
+	if err := writeConfigFile(data); err != nil {
+		t.Fatal(err)
+	}
+	if mode := fileMode(t, path); mode != 0640 {
+		t.Errorf("mode = %o, want the original 640", mode)
+	}
+
+	// 有token时去掉组和其他用户的权限
+	data.RefreshToken = "refresh"
+	if err := writeConfigFile(data); err != nil {
+		t.Fatal(err)
+	}
+	if mode := fileMode(t, path); mode != 0600 {
+		t.Errorf("mode with secrets = %o, want 600", mode)
+	}
+}
+
+func TestReadConfigFileMigration(t *testing.T) {
+	// 没有version字段的旧配置文件，access_token为占位符
+	const old = `{"app_path":"/apps/test/","access_token":"your_access_token_here","refresh_token":"","oauth":{"client_id":"id","client_secret":"your_secret_key_here"}}`
+	path := useTestConfig(t, old, 0600)
+	data, err := readConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.AccessToken != "" || data.Version != configVersion {
+		t.Errorf("migrated config = %+v", data.Config)
+	}
+	content, _ := os.ReadFile(path)
+	if strings.Contains(string(content), "access_token") || !strings.Contains(string(content), `"version": 1`) {
+		t.Errorf("config not rewritten after migration:\n%s", content)
+	}
+	if backup, _ := os.ReadFile(path + ".v0.bak"); string(backup) != old {
+		t.Errorf("backup = %s", backup)
+	}
+	if runtime.GOOS != "windows" {
+		if mode := fileMode(t, path); mode != 0600 {
+			t.Errorf("mode = %o, want 600", mode)
+		}
+	}
+}
+
+func TestReadConfigFileMigrationKeepsSecrets(t *testing.T) {
+	// 仍有真实token的旧配置文件只在内存中升级，不写回也不改变权限
+	const old = `{"app_path":"/apps/test/","access_token":"tok","refresh_token":"ref","expires_at":"","oauth":{"client_id":"id","client_secret":"secret"}}`
+	path := useTestConfig(t, old, 0600)
+	data, err := readConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.AccessToken != "tok" || data.RefreshToken != "ref" || data.ExpiresAt != nil {
+		t.Errorf("migrated config = %+v", data.Config)
+	}
+	if content, _ := os.ReadFile(path); string(content) != old {
+		t.Errorf("config with secrets rewritten:\n%s", content)
+	}
+	if _, err := os.Stat(path + ".v0.bak"); !os.IsNotExist(err) {
+		t.Errorf("unexpected backup: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		if mode := fileMode(t, path); mode != 0600 {
+			t.Errorf("mode = %o, want 600", mode)
+		}
+	}
+}
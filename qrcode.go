@@ -0,0 +1,434 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// 终端二维码：字节模式、纠错等级L、版本1-10，足够编码授权链接
+
+// 各版本的块结构（纠错等级L）
+type qrVersion struct {
+	ecPerBlock int   // 每块的纠错码字数
+	blocks     []int // 每块的数据码字数
+	align      []int // 校正图形中心坐标
+}
+
+var qrVersions = []qrVersion{
+	{7, []int{19}, nil},
+	{10, []int{34}, []int{6, 18}},
+	{15, []int{55}, []int{6, 22}},
+	{20, []int{80}, []int{6, 26}},
+	{26, []int{108}, []int{6, 30}},
+	{18, []int{68, 68}, []int{6, 34}},
+	{20, []int{78, 78}, []int{6, 22, 38}},
+	{24, []int{97, 97}, []int{6, 24, 42}},
+	{30, []int{116, 116}, []int{6, 26, 46}},
+	{18, []int{68, 68, 69, 69}, []int{6, 28, 50}},
+}
+
+// 二维码模块矩阵，true为深色
+type QRCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // 功能图形区域，不放置数据也不掩模
+}
+
+// 将文本编码为二维码，内容过长时返回错误
+func encodeQRCode(text string) (*QRCode, error) {
+	data := []byte(text)
+	for v := 1; v <= len(qrVersions); v++ {
+		info := qrVersions[v-1]
+		capacity := 0
+		for _, n := range info.blocks {
+			capacity += n
+		}
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+len(data)*8 > capacity*8 {
+			continue
+		}
+
+		codewords := qrDataCodewords(data, countBits, capacity)
+		qr := newQRCode(v)
+		qr.drawData(qrInterleave(codewords, info))
+		qr.applyBestMask()
+		return qr, nil
+	}
+	return nil, errors.New("内容过长，无法生成二维码")
+}
+
+// 模式指示、字符数、数据和填充
+func qrDataCodewords(data []byte, countBits, capacity int) []byte {
+	var bits []bool
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (v>>i)&1 == 1)
+		}
+	}
+	appendBits(0x4, 4) // 字节模式
+	appendBits(len(data), countBits)
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	// 终止符，再补齐到整字节
+	for i := 0; i < 4 && len(bits) < capacity*8; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// 分块计算纠错码，并按列交错排列
+func qrInterleave(codewords []byte, info qrVersion) []byte {
+	var dataBlocks, ecBlocks [][]byte
+	offset := 0
+	for _, n := range info.blocks {
+		block := codewords[offset : offset+n]
+		offset += n
+		dataBlocks = append(dataBlocks, block)
+		ecBlocks = append(ecBlocks, reedSolomon(block, info.ecPerBlock))
+	}
+
+	var result []byte
+	for i := 0; i < info.blocks[len(info.blocks)-1]; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// GF(256)乘法，本原多项式 x^8+x^4+x^3+x^2+1
+func gfMultiply(x, y byte) byte {
+	var z byte
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x1D)
+		z ^= ((y >> uint(i)) & 1) * x
+	}
+	return z
+}
+
+// 计算data的n个纠错码字
+func reedSolomon(data []byte, n int) []byte {
+	// 生成多项式 (x-α^0)(x-α^1)...(x-α^(n-1))，省略最高次项系数1
+	generator := make([]byte, n)
+	generator[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			generator[j] = gfMultiply(generator[j], root)
+			if j+1 < n {
+				generator[j] ^= generator[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	result := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[n-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(generator[i], factor)
+		}
+	}
+	return result
+}
+
+// 创建指定版本的二维码并绘制功能图形
+func newQRCode(version int) *QRCode {
+	size := version*4 + 17
+	qr := &QRCode{size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, size)
+		qr.function[i] = make([]bool, size)
+	}
+
+	// 定时图形
+	for i := 0; i < size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+	// 位置探测图形及分隔符
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					dist := qrAbs(dx)
+					if qrAbs(dy) > dist {
+						dist = qrAbs(dy)
+					}
+					qr.setFunction(x, y, dist != 2 && dist != 4)
+				}
+			}
+		}
+	}
+	// 校正图形，与位置探测图形重叠的位置除外
+	align := qrVersions[version-1].align
+	for i, x := range align {
+		for j, y := range align {
+			if (i == 0 && j == 0) || (i == 0 && j == len(align)-1) || (i == len(align)-1 && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					dist := qrAbs(dx)
+					if qrAbs(dy) > dist {
+						dist = qrAbs(dy)
+					}
+					qr.setFunction(x+dx, y+dy, dist != 1)
+				}
+			}
+		}
+	}
+	// 先占用格式信息区域，选定掩模后再写入
+	qr.drawFormat(0)
+	// 版本信息
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, b := size-11+i%3, i/3
+			qr.setFunction(a, b, dark)
+			qr.setFunction(b, a, dark)
+		}
+	}
+	return qr
+}
+
+func qrAbs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (qr *QRCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// 写入纠错等级L和掩模编号对应的格式信息
+func (qr *QRCode) drawFormat(mask int) {
+	data := 1<<3 | mask // 纠错等级L的指示符为01
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true) // 固定的深色模块
+}
+
+// 从右下角开始按两列一组之字形放置数据
+func (qr *QRCode) drawData(data []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert
+				}
+				if !qr.function[y][x] && i < len(data)*8 {
+					qr.modules[y][x] = (data[i>>3]>>(7-uint(i&7)))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func qrMaskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// 对数据区域应用掩模，再次调用相同的掩模可以还原
+func (qr *QRCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if !qr.function[y][x] && qrMaskBit(mask, x, y) {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// 选择扣分最少的掩模
+func (qr *QRCode) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormat(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask)
+	}
+	qr.applyMask(best)
+	qr.drawFormat(best)
+}
+
+// 按规范计算掩模扣分：连续同色、2x2同色块、类似位置探测图形的序列和深浅比例
+func (qr *QRCode) penalty() int {
+	penalty := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return qr.modules[x][y]
+		}
+		return qr.modules[y][x]
+	}
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < qr.size; y++ {
+			run := 1
+			for x := 1; x <= qr.size; x++ {
+				if x < qr.size && at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += 3 + run - 5
+				}
+				run = 1
+			}
+			for x := 0; x+11 <= qr.size; x++ {
+				for _, pattern := range finderLike {
+					matched := true
+					for k, dark := range pattern {
+						if at(x+k, y, vertical) != dark {
+							matched = false
+							break
+						}
+					}
+					if matched {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x+1 < qr.size && y+1 < qr.size {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := qr.size * qr.size
+	k := (qrAbs(dark*20-total*10)+total-1)/total - 1
+	penalty += k * 10
+	return penalty
+}
+
+// 使用半高方块字符输出二维码，每个字符表示上下两个模块，颜色固定为黑白以适应深色和浅色终端
+func (qr *QRCode) print(w io.Writer) {
+	const quiet = 2
+	dark := func(x, y int) bool {
+		x, y = x-quiet, y-quiet
+		return x >= 0 && x < qr.size && y >= 0 && y < qr.size && qr.modules[y][x]
+	}
+	color := func(isDark bool, fg bool) string {
+		switch {
+		case isDark && fg:
+			return "30"
+		case isDark:
+			return "40"
+		case fg:
+			return "97"
+		default:
+			return "107"
+		}
+	}
+
+	var sb strings.Builder
+	total := qr.size + quiet*2
+	for y := 0; y < total; y += 2 {
+		for x := 0; x < total; x++ {
+			sb.WriteString("\x1b[" + color(dark(x, y), true) + ";" + color(dark(x, y+1), false) + "m▀")
+		}
+		sb.WriteString("\x1b[0m\n")
+	}
+	io.WriteString(w, sb.String())
+}
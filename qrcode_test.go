@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// ISO/IEC 18004 附录中 "01234567" 1-M 示例的数据码字和纠错码字
+func TestReedSolomon(t *testing.T) {
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	want := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	if got := reedSolomon(data, len(want)); !bytes.Equal(got, want) {
+		t.Errorf("reedSolomon = % X, want % X", got, want)
+	}
+}
+
+func TestQRDataCodewords(t *testing.T) {
+	// 0100 00000001 01000001 0000，之后用EC/11交替填充
+	want := []byte{0x40, 0x14, 0x10, 0xEC, 0x11, 0xEC}
+	if got := qrDataCodewords([]byte("A"), 8, 6); !bytes.Equal(got, want) {
+		t.Errorf("qrDataCodewords = % X, want % X", got, want)
+	}
+}
+
+func TestEncodeQRCodeVersion(t *testing.T) {
+	for _, tc := range []struct {
+		length, size int
+	}{
+		{1, 21},
+		{17, 21}, // 版本1-L最多17字节
+		{18, 25},
+		{271, 57}, // 版本10字符数占16位，最多271字节
+	} {
+		qr, err := encodeQRCode(strings.Repeat("a", tc.length))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tc.length, err)
+		}
+		if qr.size != tc.size {
+			t.Errorf("%d bytes: size = %d, want %d", tc.length, qr.size, tc.size)
+		}
+	}
+	if _, err := encodeQRCode(strings.Repeat("a", 272)); err == nil {
+		t.Error("272 bytes should be too long")
+	}
+}
+
+// 按规范读取格式信息、去掉掩模并解交错，检查能还原出原始文本
+func TestEncodeQRCodeRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"https://openapi.baidu.com/device?code=ABCD1234",
+		strings.Repeat("测试", 40),
+	} {
+		qr, err := encodeQRCode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decodeTestQRCode(t, qr); got != text {
+			t.Errorf("decoded %q, want %q", got, text)
+		}
+	}
+}
+
+func decodeTestQRCode(t *testing.T, qr *QRCode) string {
+	t.Helper()
+	version := (qr.size - 17) / 4
+	info := qrVersions[version-1]
+
+	// 左上角的格式信息，与右上角、左下角的副本比较
+	var format, copy2 int
+	for i := 0; i < 15; i++ {
+		var a, b bool
+		switch {
+		case i <= 5:
+			a = qr.modules[i][8]
+		case i <= 7:
+			a = qr.modules[i+1][8]
+		case i == 8:
+			a = qr.modules[8][7]
+		default:
+			a = qr.modules[8][14-i]
+		}
+		if i < 8 {
+			b = qr.modules[8][qr.size-1-i]
+		} else {
+			b = qr.modules[qr.size-15+i][8]
+		}
+		if a {
+			format |= 1 << i
+		}
+		if b {
+			copy2 |= 1 << i
+		}
+	}
+	if format != copy2 {
+		t.Fatalf("format copies differ: %015b %015b", format, copy2)
+	}
+	format ^= 0x5412
+	if format>>13 != 1 {
+		t.Fatalf("error correction level bits = %02b, want 01 (L)", format>>13)
+	}
+	mask := format >> 10 & 7
+
+	// 从右下角开始两列一组之字形读取数据模块
+	var bits []bool
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (qr.size-1-right)/2%2 == 0
+		for vert := 0; vert < qr.size; vert++ {
+			y := vert
+			if upward {
+				y = qr.size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if !qr.function[y][x] {
+					bits = append(bits, qr.modules[y][x] != qrMaskBit(mask, x, y))
+				}
+			}
+		}
+	}
+	readByte := func(i int) byte {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		return b
+	}
+
+	// 解交错，并检查每块的纠错码字
+	blocks := make([][]byte, len(info.blocks))
+	n := 0
+	for i := 0; i < info.blocks[len(info.blocks)-1]; i++ {
+		for k := range blocks {
+			if i < info.blocks[k] {
+				blocks[k] = append(blocks[k], readByte(n))
+				n++
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for k := range blocks {
+			if want := reedSolomon(blocks[k], info.ecPerBlock)[i]; readByte(n) != want {
+				t.Fatalf("block %d ec codeword %d = %X, want %X", k, i, readByte(n), want)
+			}
+			n++
+		}
+	}
+	data := bytes.Join(blocks, nil)
+
+	// 字节模式：4位模式指示、字符数、数据
+	if data[0]>>4 != 0x4 {
+		t.Fatalf("mode = %X, want byte mode", data[0]>>4)
+	}
+	var length, offset int
+	if version >= 10 {
+		length = int(data[0]&0xF)<<12 | int(data[1])<<4 | int(data[2]>>4)
+		offset = 2
+	} else {
+		length = int(data[0]&0xF)<<4 | int(data[1]>>4)
+		offset = 1
+	}
+	text := make([]byte, length)
+	for i := range text {
+		text[i] = data[offset+i]<<4 | data[offset+i+1]>>4
+	}
+	return string(text)
+}
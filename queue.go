@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"bddisk_uploader/logger"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+const (
+	QueueDirName    = "queue" // 任务队列在缓存目录下的子目录
+	queueCompactMin = 1000    // 记录数超过该值且超过未完成任务数的2倍时压缩
+)
+
+// 任务队列中文件的状态
+const (
+	TaskPending = "pending"
+	TaskRunning = "running"
+	TaskDone    = "done"
+	TaskFailed  = "failed"
+)
+
+// 任务队列中的一条记录，同一文件以最后一条记录为准
+type QueueTask struct {
+	LocalPath  string    `json:"local_path"`
+	RemotePath string    `json:"remote_path"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mtime"`
+	State      string    `json:"state"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// 队列文件的第一行，记录创建队列时影响文件列表的参数
+type queueHeader struct {
+	Options string `json:"options"`
+}
+
+func (t *QueueTask) fileInfo() FileInfo {
+	return FileInfo{LocalPath: t.LocalPath, RemotePath: t.RemotePath, Size: t.Size, ModTime: t.ModTime}
+}
+
+// 文件夹上传的任务队列，保存在缓存目录的 queue/ 中。
+// 每次状态变化追加一行记录，进程中断后重新运行时直接上传未完成的文件，无需重新扫描和对比；
+// 不使用任务队列时为nil，setState 和 close 可以在nil上调用
+type UploadQueue struct {
+	path    string
+	options string // 创建队列时的参数，参数变化后需要重新扫描
+	mu      sync.Mutex
+	file    *os.File
+	tasks   map[string]*QueueTask // 本地路径 -> 任务
+	order   []string              // 加入队列的顺序
+	records int                   // 日志中的记录数
+}
+
+// 任务队列文件路径，由文件夹绝对路径和是否保持目录结构共同决定
+func uploadQueuePath(cacheDir, folderPath string, keepStructure bool) string {
+	if absPath, err := filepath.Abs(folderPath); err == nil {
+		folderPath = absPath
+	}
+	sum := sha1.Sum([]byte(folderPath + "\x00" + strconv.FormatBool(keepStructure)))
+	return filepath.Join(cacheDir, QueueDirName, hex.EncodeToString(sum[:])+".log")
+}
+
+// 影响文件列表和同步结果的参数，syncOpts为nil表示非同步模式
+func uploadQueueOptions(excludePatterns []string, syncOpts *SyncOptions) string {
+	options := struct {
+		Exclude  []string `json:"exclude,omitempty"`
+		Sync     bool     `json:"sync,omitempty"`
+		Checksum bool     `json:"checksum,omitempty"`
+		Mirror   bool     `json:"mirror,omitempty"`
+	}{Exclude: excludePatterns}
+	if syncOpts != nil {
+		options.Sync = true
+		options.Checksum = syncOpts.Checksum
+		options.Mirror = syncOpts.Mirror
+	}
+	data, _ := json.Marshal(options)
+	return string(data)
+}
+
+// 删除任务队列
+func removeUploadQueue(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		logger.Warn("删除任务队列失败: %s - %v", path, err)
+	}
+}
+
+// 加载任务队列，不存在、已损坏、参数不同或没有待上传的任务时返回nil；
+// 只剩上传失败的任务时也删除队列，由重新扫描决定是否重试
+func loadUploadQueue(path, options string) *UploadQueue {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("读取任务队列失败: %v", err)
+		}
+		return nil
+	}
+
+	q := &UploadQueue{path: path, tasks: make(map[string]*QueueTask)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var header *queueHeader
+	for scanner.Scan() {
+		if header == nil {
+			header = &queueHeader{}
+			json.Unmarshal(scanner.Bytes(), header)
+			continue
+		}
+		var task QueueTask
+		// 进程中断时最后一行可能只写了一半，忽略无法解析的记录
+		if err := json.Unmarshal(scanner.Bytes(), &task); err != nil || task.LocalPath == "" {
+			continue
+		}
+		q.apply(&task)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Warn("任务队列已损坏，将重新扫描: %v", err)
+		return nil
+	}
+	if header == nil || header.Options != options {
+		logger.Info("上次的任务队列使用了不同的参数，重新扫描文件夹")
+		removeUploadQueue(path)
+		return nil
+	}
+	if q.remaining() == 0 {
+		removeUploadQueue(path)
+		return nil
+	}
+	q.options = options
+
+	// 上次正在上传的文件视为未开始，由上传日志继续未完成的分片
+	for _, task := range q.tasks {
+		if task.State == TaskRunning {
+			task.State = TaskPending
+		}
+	}
+	if err := q.compact(); err != nil {
+		logger.Warn("打开任务队列失败，将重新扫描: %v", err)
+		return nil
+	}
+	return q
+}
+
+// 创建新的任务队列，已有的队列会被覆盖
+func createUploadQueue(path, options string, files []FileInfo) (*UploadQueue, error) {
+	q := &UploadQueue{path: path, options: options, tasks: make(map[string]*QueueTask, len(files))}
+	for _, f := range files {
+		q.apply(&QueueTask{LocalPath: f.LocalPath, RemotePath: f.RemotePath, Size: f.Size, ModTime: f.ModTime, State: TaskPending})
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *UploadQueue) apply(task *QueueTask) {
+	if _, ok := q.tasks[task.LocalPath]; !ok {
+		q.order = append(q.order, task.LocalPath)
+	}
+	q.tasks[task.LocalPath] = task
+	q.records++
+}
+
+// 等待上传或中断时正在上传的任务数，不包括上传失败的任务
+func (q *UploadQueue) remaining() int {
+	n := 0
+	for _, task := range q.tasks {
+		if task.State == TaskPending || task.State == TaskRunning {
+			n++
+		}
+	}
+	return n
+}
+
+// 按加入顺序返回未完成的文件
+func (q *UploadQueue) pendingFiles() []FileInfo {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var files []FileInfo
+	for _, localPath := range q.order {
+		if task := q.tasks[localPath]; task.State != TaskDone {
+			files = append(files, task.fileInfo())
+		}
+	}
+	return files
+}
+
+// 只保留未完成的任务重写队列文件，之后继续追加
+func (q *UploadQueue) compact() error {
+	var buf bytes.Buffer
+	header, err := json.Marshal(queueHeader{Options: q.options})
+	if err != nil {
+		return err
+	}
+	buf.Write(header)
+	buf.WriteByte('\n')
+	order := q.order[:0]
+	for _, localPath := range q.order {
+		task := q.tasks[localPath]
+		if task.State == TaskDone {
+			delete(q.tasks, localPath)
+			continue
+		}
+		order = append(order, localPath)
+		line, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	q.order = order
+	q.records = len(order)
+
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("创建任务队列目录失败: %v", err)
+	}
+	if err := writeFileAtomic(q.path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("保存任务队列失败: %v", err)
+	}
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	q.file = file
+	return nil
+}
+
+// 更新文件状态并追加到队列文件
+func (q *UploadQueue) setState(localPath, state string, taskErr error) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	task, ok := q.tasks[localPath]
+	if !ok || q.file == nil {
+		return
+	}
+	updated := *task
+	updated.State = state
+	updated.Error = ""
+	if taskErr != nil {
+		// 队列文件保存在缓存目录中，错误信息里不能留下请求地址中的token
+		updated.Error = utils.RedactAccessToken(taskErr.Error())
+	}
+	q.apply(&updated)
+
+	if q.records > queueCompactMin && q.records > 2*len(q.tasks) {
+		if err := q.compact(); err != nil {
+			logger.Warn("压缩任务队列失败: %v", err)
+		}
+		return
+	}
+	line, err := json.Marshal(&updated)
+	if err == nil {
+		_, err = q.file.Write(append(line, '\n'))
+	}
+	if err != nil {
+		logger.Warn("保存任务队列失败: %v", err)
+	}
+}
+
+// 关闭队列文件，没有待上传的文件时删除队列，上传失败的文件下次重新扫描时再处理
+func (q *UploadQueue) close() {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+	if q.remaining() == 0 {
+		removeUploadQueue(q.path)
+	}
+}
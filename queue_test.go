@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func newTestQueue(t *testing.T, options string) (*UploadQueue, []FileInfo) {
+	t.Helper()
+	files := []FileInfo{
+		{LocalPath: "/data/a", RemotePath: "data/a", Size: 1},
+		{LocalPath: "/data/b", RemotePath: "data/b", Size: 2},
+		{LocalPath: "/data/c", RemotePath: "data/c", Size: 3},
+	}
+	queue, err := createUploadQueue(filepath.Join(t.TempDir(), "queue", "q.log"), options, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queue, files
+}
+
+func queueFilePaths(files []FileInfo) []string {
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.LocalPath)
+	}
+	return paths
+}
+
+func TestUploadQueueResume(t *testing.T) {
+	options := uploadQueueOptions([]string{"*.tmp"}, nil)
+	queue, _ := newTestQueue(t, options)
+	queue.setState("/data/a", TaskDone, nil)
+	queue.setState("/data/b", TaskFailed, errors.New("boom"))
+	queue.setState("/data/c", TaskRunning, nil)
+	queue.close()
+
+	// 中断时正在上传的文件和失败的文件都会继续上传
+	resumed := loadUploadQueue(queue.path, options)
+	if resumed == nil {
+		t.Fatal("queue not resumed")
+	}
+	defer resumed.close()
+	got := queueFilePaths(resumed.pendingFiles())
+	if len(got) != 2 || got[0] != "/data/b" || got[1] != "/data/c" {
+		t.Errorf("pendingFiles = %v, want [/data/b /data/c]", got)
+	}
+	if task := resumed.tasks["/data/c"]; task.State != TaskPending {
+		t.Errorf("running task state = %s, want pending", task.State)
+	}
+}
+
+func TestUploadQueueOnlyFailedLeft(t *testing.T) {
+	options := uploadQueueOptions(nil, nil)
+	queue, _ := newTestQueue(t, options)
+	queue.setState("/data/a", TaskDone, nil)
+	queue.setState("/data/b", TaskDone, nil)
+	queue.setState("/data/c", TaskFailed, errors.New("boom"))
+	queue.close()
+
+	if _, err := os.Stat(queue.path); !os.IsNotExist(err) {
+		t.Errorf("queue with only failed tasks not removed: %v", err)
+	}
+	if loadUploadQueue(queue.path, options) != nil {
+		t.Error("queue with only failed tasks should not be resumed")
+	}
+}
+
+func TestUploadQueueOptionsChanged(t *testing.T) {
+	queue, _ := newTestQueue(t, uploadQueueOptions(nil, &SyncOptions{}))
+	queue.close()
+
+	if loadUploadQueue(queue.path, uploadQueueOptions(nil, &SyncOptions{Mirror: true})) != nil {
+		t.Error("queue created without -mirror should not be resumed with -mirror")
+	}
+	if _, err := os.Stat(queue.path); !os.IsNotExist(err) {
+		t.Errorf("queue with different options not removed: %v", err)
+	}
+}
+
+func TestUploadQueueTruncatedRecord(t *testing.T) {
+	options := uploadQueueOptions(nil, nil)
+	queue, _ := newTestQueue(t, options)
+	queue.setState("/data/a", TaskDone, nil)
+	queue.close()
+
+	// 模拟写入记录时进程中断
+	f, err := os.OpenFile(queue.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"local_path":"/data/b","sta`)
+	f.Close()
+
+	resumed := loadUploadQueue(queue.path, options)
+	if resumed == nil {
+		t.Fatal("queue not resumed")
+	}
+	defer resumed.close()
+	if got := queueFilePaths(resumed.pendingFiles()); len(got) != 2 || got[0] != "/data/b" {
+		t.Errorf("pendingFiles = %v, want [/data/b /data/c]", got)
+	}
+}
+
+func TestUploadQueueRedactsToken(t *testing.T) {
+	queue, _ := newTestQueue(t, uploadQueueOptions(nil, nil))
+	queue.setState("/data/a", TaskFailed, errors.New(`Post "https://d.pcs.baidu.com/rest/2.0/pcs/superfile2?access_token=121.secret&method=upload": i/o timeout`))
+	queue.close()
+
+	data, err := os.ReadFile(queue.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "121.secret") || !strings.Contains(string(data), "access_token=***") {
+		t.Errorf("queue file = %s", data)
+	}
+	if runtime.GOOS != "windows" {
+		if mode := fileMode(t, queue.path); mode != 0600 {
+			t.Errorf("queue file mode = %o, want 600", mode)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"bddisk_uploader/logger"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+)
+
+// 列表接口单页最大条数
+const ListPageSize = 1000
+
+// 文件列表接口使用的SDK客户端，加载配置后重新创建
+var fileClient = file.NewClient()
+
+// 子命令入口，返回进程退出码
+var subcommands = map[string]func(args []string) int{
+	"ls":          runLs,
+	"tree":        runTree,
+	"stat":        runStat,
+	"du":          runDu,
+	"download":    runDownload,
+	"index":       runIndex,
+	"serve":       runServe,
+	"profiles":    runProfiles,
+	"credentials": runCredentials,
+	"config":      runConfig,
+	"doctor":      runDoctor,
+}
+
+// 远程文件信息，用于--json输出
+type RemoteEntry struct {
+	Path  string `json:"path"`
+	Name  string `json:"name"`
+	IsDir bool   `json:"is_dir"`
+	Size  int64  `json:"size"`
+	FsId  uint64 `json:"fs_id"`
+	Md5   string `json:"md5,omitempty"`
+	Mtime int64  `json:"mtime"`
+	Ctime int64  `json:"ctime"`
+}
+
+func newRemoteEntry(e file.FileEntry) RemoteEntry {
+	name := e.ServerFilename
+	if name == "" {
+		name = path.Base(e.Path)
+	}
+	return RemoteEntry{
+		Path:  e.Path,
+		Name:  name,
+		IsDir: e.IsDir(),
+		Size:  int64(e.Size),
+		FsId:  e.FsId,
+		Md5:   e.Md5,
+		Mtime: e.ServerMtime,
+		Ctime: e.ServerCtime,
+	}
+}
+
+// 将命令行中的远程路径解析为网盘绝对路径，相对路径基于app_path
+func resolveRemotePath(appPath, p string) string {
+	root := path.Clean("/" + appPath)
+	if p == "" {
+		return root
+	}
+	if cleaned := path.Clean(p); cleaned == root || strings.HasPrefix(cleaned, root+"/") {
+		return cleaned
+	}
+	// 其余路径（包括以/开头的）都视为相对app_path，不允许跳出应用目录
+	return path.Join(root, path.Clean("/"+p))
+}
+
+// 子命令公共的初始化：解析参数、加载配置、刷新token
+func setupRemoteCommand(fs *flag.FlagSet, args []string) (*Config, error) {
+	if err := logger.InitWithConsole(logger.INFO, os.Stderr, "", false); err != nil {
+		return nil, err
+	}
+	addConfigFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	initSDKClients(config)
+	if _, err := tokens.token(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// 子命令出错时输出错误信息并返回退出码
+func commandFailed(ctx context.Context, err error) int {
+	if ctx.Err() != nil {
+		logger.Warn("操作已中断: %v", err)
+		return 130
+	}
+	logger.Error("%v", err)
+	if hint := errorHint(err); hint != "" {
+		logger.Error("提示: %s", hint)
+	}
+	return 1
+}
+
+func remoteCommandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// 分页获取目录下的所有文件（不递归）
+func listDir(ctx context.Context, dir string) ([]file.FileEntry, error) {
+	var entries []file.FileEntry
+	for start := 0; ; start += ListPageSize {
+		var ret file.ListReturn
+		err := withToken(func(accessToken string) (err error) {
+			ret, err = fileClient.ListWithContext(ctx, accessToken, file.NewListArg(dir, start, ListPageSize))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("列出目录 %s 失败: %w", dir, err)
+		}
+		entries = append(entries, ret.List...)
+		if len(ret.List) < ListPageSize {
+			return entries, nil
+		}
+	}
+}
+
+// 递归获取目录下的所有文件和子目录
+func listAllRecursive(ctx context.Context, dir string) ([]file.FileEntry, error) {
+	var entries []file.FileEntry
+	cursor := 0
+	for {
+		var ret file.ListAllReturn
+		err := withToken(func(accessToken string) (err error) {
+			ret, err = fileClient.ListAllWithContext(ctx, accessToken, file.NewListAllArg(dir, true, cursor, ListPageSize))
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("递归列出目录 %s 失败: %w", dir, err)
+		}
+		entries = append(entries, ret.List...)
+		if ret.HasMore == 0 || ret.Cursor <= cursor {
+			return entries, nil
+		}
+		cursor = ret.Cursor
+	}
+}
+
+// 获取单个远程路径的信息，通过列出父目录查找
+func statRemote(ctx context.Context, config *Config, remotePath string) (RemoteEntry, error) {
+	if remotePath == resolveRemotePath(config.AppPath, "") {
+		// 应用根目录无法通过列出父目录获取，直接视为目录
+		return RemoteEntry{Path: remotePath, Name: path.Base(remotePath), IsDir: true}, nil
+	}
+
+	entries, err := listDir(ctx, path.Dir(remotePath))
+	if err != nil {
+		return RemoteEntry{}, err
+	}
+	for _, e := range entries {
+		if e.Path == remotePath {
+			return newRemoteEntry(e), nil
+		}
+	}
+	return RemoteEntry{}, fmt.Errorf("远程路径不存在: %s", remotePath)
+}
+
+func formatUnixTime(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.Unix(ts, 0).Format("2006-01-02 15:04")
+}
+
+func remotePathArg(fs *flag.FlagSet, config *Config) string {
+	return resolveRemotePath(config.AppPath, fs.Arg(0))
+}
+
+// ls [--json] [远程目录]
+func runLs(args []string) int {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	config, err := setupRemoteCommand(fs, args)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	ctx, stop := remoteCommandContext()
+	defer stop()
+
+	dir := remotePathArg(fs, config)
+	entries, err := listDir(ctx, dir)
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+
+	result := make([]RemoteEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, newRemoteEntry(e))
+	}
+	if *jsonOutput {
+		if err := printJSON(result); err != nil {
+			return commandFailed(ctx, err)
+		}
+		return 0
+	}
+
+	for _, e := range result {
+		size := formatFileSize(e.Size)
+		name := e.Name
+		if e.IsDir {
+			size = "-"
+			name += "/"
+		}
+		fmt.Printf("%10s  %s  %s\n", size, formatUnixTime(e.Mtime), name)
+	}
+	return 0
+}
+
+// 目录树节点，用于tree输出
+type RemoteTreeNode struct {
+	RemoteEntry
+	Children []*RemoteTreeNode `json:"children,omitempty"`
+}
+
+// 根据递归列表构建目录树，depth大于0时限制展示层数
+func buildRemoteTree(root RemoteEntry, entries []file.FileEntry, depth int) *RemoteTreeNode {
+	rootNode := &RemoteTreeNode{RemoteEntry: root}
+	nodes := map[string]*RemoteTreeNode{root.Path: rootNode}
+
+	// 按路径排序，保证父目录先于子项出现
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	for _, e := range entries {
+		rel := strings.TrimPrefix(e.Path, root.Path+"/")
+		if depth > 0 && strings.Count(rel, "/") >= depth {
+			continue
+		}
+		parent, ok := nodes[path.Dir(e.Path)]
+		if !ok {
+			continue
+		}
+		node := &RemoteTreeNode{RemoteEntry: newRemoteEntry(e)}
+		parent.Children = append(parent.Children, node)
+		if node.IsDir {
+			nodes[node.Path] = node
+		}
+	}
+	return rootNode
+}
+
+func printRemoteTree(node *RemoteTreeNode, prefix string) (dirs, files int) {
+	for i, child := range node.Children {
+		connector, childPrefix := "├── ", "│   "
+		if i == len(node.Children)-1 {
+			connector, childPrefix = "└── ", "    "
+		}
+		if child.IsDir {
+			fmt.Printf("%s%s%s/\n", prefix, connector, child.Name)
+			d, f := printRemoteTree(child, prefix+childPrefix)
+			dirs += d + 1
+			files += f
+		} else {
+			fmt.Printf("%s%s%s (%s)\n", prefix, connector, child.Name, formatFileSize(child.Size))
+			files++
+		}
+	}
+	return dirs, files
+}
+
+// tree [--json] [-depth N] [远程目录]
+func runTree(args []string) int {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	depth := fs.Int("depth", 0, "最多展示的目录层数，0表示不限制")
+	config, err := setupRemoteCommand(fs, args)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	ctx, stop := remoteCommandContext()
+	defer stop()
+
+	root, err := statRemote(ctx, config, remotePathArg(fs, config))
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+	if !root.IsDir {
+		return commandFailed(ctx, fmt.Errorf("%s 不是目录", root.Path))
+	}
+	entries, err := listAllRecursive(ctx, root.Path)
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+
+	tree := buildRemoteTree(root, entries, *depth)
+	if *jsonOutput {
+		if err := printJSON(tree); err != nil {
+			return commandFailed(ctx, err)
+		}
+		return 0
+	}
+
+	fmt.Printf("%s/\n", root.Path)
+	dirs, files := printRemoteTree(tree, "")
+	fmt.Printf("\n%d 个目录, %d 个文件\n", dirs, files)
+	return 0
+}
+
+// stat [--json] <远程路径>
+func runStat(args []string) int {
+	fs := flag.NewFlagSet("stat", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	config, err := setupRemoteCommand(fs, args)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	if fs.NArg() == 0 {
+		return commandFailed(context.Background(), fmt.Errorf("请指定远程路径: ./bddisk_uploader stat <远程路径>"))
+	}
+	ctx, stop := remoteCommandContext()
+	defer stop()
+
+	entry, err := statRemote(ctx, config, remotePathArg(fs, config))
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+
+	// 文件通过filemetas补全md5等元信息
+	if !entry.IsDir && entry.FsId != 0 {
+		var ret file.FileMetasReturn
+		err := withToken(func(accessToken string) (err error) {
+			ret, err = fileClient.FileMetasWithContext(ctx, accessToken, file.NewFileMetasArg([]uint64{entry.FsId}, false))
+			return err
+		})
+		if err != nil {
+			return commandFailed(ctx, fmt.Errorf("获取文件元信息失败: %w", err))
+		}
+		if len(ret.List) > 0 {
+			meta := ret.List[0]
+			entry.Size = int64(meta.Size)
+			entry.Md5 = meta.Md5
+			entry.Mtime = meta.ServerMtime
+			entry.Ctime = meta.ServerCtime
+		}
+	}
+
+	if *jsonOutput {
+		if err := printJSON(entry); err != nil {
+			return commandFailed(ctx, err)
+		}
+		return 0
+	}
+
+	kind := "文件"
+	if entry.IsDir {
+		kind = "目录"
+	}
+	fmt.Printf("路径: %s\n", entry.Path)
+	fmt.Printf("类型: %s\n", kind)
+	if !entry.IsDir {
+		fmt.Printf("大小: %s (%d 字节)\n", formatFileSize(entry.Size), entry.Size)
+		if entry.Md5 != "" {
+			fmt.Printf("MD5: %s\n", entry.Md5)
+		}
+	}
+	if entry.FsId != 0 {
+		fmt.Printf("fs_id: %d\n", entry.FsId)
+	}
+	fmt.Printf("修改时间: %s\n", formatUnixTime(entry.Mtime))
+	fmt.Printf("创建时间: %s\n", formatUnixTime(entry.Ctime))
+	return 0
+}
+
+// 目录占用统计，用于du输出
+type RemoteUsage struct {
+	Path     string        `json:"path"`
+	Size     int64         `json:"size"`
+	Files    int           `json:"files"`
+	Dirs     int           `json:"dirs"`
+	Children []RemoteUsage `json:"children,omitempty"`
+}
+
+// 统计目录总占用以及每个直接子项的占用
+func summarizeUsage(dir string, entries []file.FileEntry) RemoteUsage {
+	total := RemoteUsage{Path: dir}
+	children := make(map[string]*RemoteUsage)
+	var order []string
+
+	for _, e := range entries {
+		rel := strings.TrimPrefix(e.Path, dir+"/")
+		top := rel
+		if i := strings.Index(rel, "/"); i >= 0 {
+			top = rel[:i]
+		}
+		child, ok := children[top]
+		if !ok {
+			child = &RemoteUsage{Path: path.Join(dir, top)}
+			children[top] = child
+			order = append(order, top)
+		}
+
+		if e.IsDir() {
+			total.Dirs++
+			if rel != top {
+				child.Dirs++
+			}
+			continue
+		}
+		total.Files++
+		total.Size += int64(e.Size)
+		child.Files++
+		child.Size += int64(e.Size)
+	}
+
+	sort.Strings(order)
+	for _, name := range order {
+		total.Children = append(total.Children, *children[name])
+	}
+	return total
+}
+
+// du [--json] [远程目录]
+func runDu(args []string) int {
+	fs := flag.NewFlagSet("du", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出")
+	config, err := setupRemoteCommand(fs, args)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	ctx, stop := remoteCommandContext()
+	defer stop()
+
+	dir := remotePathArg(fs, config)
+	entries, err := listAllRecursive(ctx, dir)
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+
+	usage := summarizeUsage(dir, entries)
+	if *jsonOutput {
+		if err := printJSON(usage); err != nil {
+			return commandFailed(ctx, err)
+		}
+		return 0
+	}
+
+	for _, child := range usage.Children {
+		fmt.Printf("%10s  %s\n", formatFileSize(child.Size), child.Path)
+	}
+	fmt.Printf("%10s  %s (共 %d 个文件, %d 个目录)\n", formatFileSize(usage.Size), usage.Path, usage.Files, usage.Dirs)
+	return 0
+}
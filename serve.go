@@ -0,0 +1,552 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bddisk_uploader/logger"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+const (
+	DefaultServeAddr  = "127.0.0.1:8765"
+	maxJobRequestSize = 1 << 20
+)
+
+// 上传任务状态
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobPaused    = "paused"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// 创建上传任务的请求
+type JobRequest struct {
+	Path          string   `json:"path"`                     // 本地文件或文件夹路径
+	Remote        string   `json:"remote,omitempty"`         // 相对于app_path的远程路径，默认使用本地文件或文件夹名
+	Sync          bool     `json:"sync,omitempty"`           // 文件夹只上传新增或修改过的文件
+	Checksum      bool     `json:"checksum,omitempty"`       // 同步时大小相同但修改时间不同的文件比较MD5
+	Overwrite     bool     `json:"overwrite,omitempty"`      // 远程已有同名文件时覆盖
+	Exclude       []string `json:"exclude,omitempty"`        // 文件夹的排除模式
+	KeepStructure *bool    `json:"keep_structure,omitempty"` // 保持文件夹结构，默认启用
+}
+
+// 上传任务的状态和进度，用于接口返回
+type JobStatus struct {
+	ID            string     `json:"id"`
+	State         string     `json:"state"`
+	Request       JobRequest `json:"request"`
+	Error         string     `json:"error,omitempty"`
+	TotalFiles    int64      `json:"total_files"`
+	UploadedFiles int64      `json:"uploaded_files"`
+	FailedFiles   int64      `json:"failed_files"`
+	TotalBytes    int64      `json:"total_bytes"`
+	UploadedBytes int64      `json:"uploaded_bytes"`
+	Progress      float64    `json:"progress"` // 百分比
+	CreatedAt     time.Time  `json:"created_at"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// 上传任务，暂停后重新开始时由上传日志继续未完成的分片
+type Job struct {
+	mu       sync.Mutex
+	status   JobStatus
+	stats    *UploadStats
+	uploaded int64 // 已上传的字节数，由上传进度回调原子更新
+	cancel   context.CancelFunc
+	stopAs   string // 主动停止后的状态：paused 或 canceled
+}
+
+// 任务当前的状态和进度
+func (j *Job) snapshot() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	status := j.status
+	if j.stats != nil {
+		status.TotalFiles = atomic.LoadInt64(&j.stats.TotalFiles)
+		status.UploadedFiles = atomic.LoadInt64(&j.stats.UploadedFiles)
+		status.FailedFiles = atomic.LoadInt64(&j.stats.FailedFiles)
+		status.TotalBytes = atomic.LoadInt64(&j.stats.TotalSize)
+	}
+	status.UploadedBytes = atomic.LoadInt64(&j.uploaded)
+	if status.UploadedBytes > status.TotalBytes {
+		status.UploadedBytes = status.TotalBytes
+	}
+	switch {
+	case status.State == JobCompleted:
+		status.Progress = 100
+	case status.TotalBytes > 0:
+		status.Progress = float64(status.UploadedBytes) / float64(status.TotalBytes) * 100
+	}
+	return status
+}
+
+// 上传任务服务，任务保存在内存中
+type jobServer struct {
+	ctx      context.Context
+	config   *Config
+	token    string // 访问接口需要的Bearer token
+	cacheDir string
+	opts     *UploadOptions
+	files    int           // 单个任务同时上传的文件数
+	slots    chan struct{} // 同时运行的任务数
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	wg       sync.WaitGroup
+}
+
+// 随机生成接口的访问token
+func newServeToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("生成访问token失败: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// 检查并规范化任务请求
+func normalizeJobRequest(req *JobRequest) error {
+	if req.Path == "" {
+		return errors.New("缺少 path")
+	}
+	absPath, err := filepath.Abs(req.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(absPath); err != nil {
+		return fmt.Errorf("本地路径不可用: %v", err)
+	}
+	req.Path = absPath
+	// 远程路径不能跳出app_path
+	if req.Remote != "" {
+		req.Remote = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(req.Remote, "\\", "/")), "/")
+	}
+	return nil
+}
+
+// 添加任务并排队执行
+func (s *jobServer) add(req JobRequest) *Job {
+	job := &Job{status: JobStatus{ID: newJobID(), Request: req, CreatedAt: time.Now()}}
+	s.mu.Lock()
+	s.jobs[job.status.ID] = job
+	s.mu.Unlock()
+	s.start(job)
+	return job
+}
+
+func (s *jobServer) get(id string) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// 按创建时间排序的所有任务
+func (s *jobServer) list() []JobStatus {
+	s.mu.Lock()
+	jobs := make([]*Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		statuses = append(statuses, job.snapshot())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].CreatedAt.Before(statuses[j].CreatedAt) })
+	return statuses
+}
+
+// 任务进入排队状态，有空闲的运行名额后开始上传。
+// 指定了 from 时任务必须处于其中一个状态，检查和状态切换在同一次加锁中完成，
+// 同时到达的多个继续请求只会启动一次
+func (s *jobServer) start(job *Job, from ...string) error {
+	job.mu.Lock()
+	allowed := len(from) == 0
+	for _, state := range from {
+		allowed = allowed || job.status.State == state
+	}
+	if !allowed {
+		state := job.status.State
+		job.mu.Unlock()
+		return fmt.Errorf("任务当前状态为 %s，无法继续", state)
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	job.status.State = JobQueued
+	job.status.Error = ""
+	job.status.FinishedAt = nil
+	job.cancel = cancel
+	job.stopAs = ""
+	job.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+
+		var err error
+		select {
+		case s.slots <- struct{}{}:
+			err = s.run(ctx, job)
+			<-s.slots
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		now := time.Now()
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		switch {
+		case job.stopAs != "":
+			job.status.State = job.stopAs
+		case err != nil:
+			job.status.State = JobFailed
+			job.status.Error = utils.RedactAccessToken(err.Error())
+		default:
+			job.status.State = JobCompleted
+		}
+		if job.status.State != JobPaused {
+			job.status.FinishedAt = &now
+		}
+		logger.Info("任务 %s 已结束: %s", job.status.ID, job.status.State)
+	}()
+	return nil
+}
+
+// 停止排队中或正在运行的任务，state 为停止后的状态
+func (s *jobServer) stop(job *Job, state string) error {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.status.State != JobQueued && job.status.State != JobRunning {
+		return fmt.Errorf("任务当前状态为 %s，无法停止", job.status.State)
+	}
+	job.stopAs = state
+	job.cancel()
+	return nil
+}
+
+// 继续已暂停或失败的任务
+func (s *jobServer) resume(job *Job) error {
+	return s.start(job, JobPaused, JobFailed)
+}
+
+// 任务使用的配置副本，access_token即将过期时先刷新
+func (s *jobServer) jobConfig() (*Config, error) {
+	if _, err := tokens.token(); err != nil {
+		return nil, err
+	}
+	config := *s.config
+	return &config, nil
+}
+
+// 收集任务需要上传的文件，远程路径相对于app_path
+func (s *jobServer) collectJobFiles(ctx context.Context, config *Config, req JobRequest) ([]FileInfo, error) {
+	info, err := os.Stat(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	remoteRoot := req.Remote
+	if remoteRoot == "" {
+		remoteRoot = filepath.Base(req.Path)
+	}
+	if !info.IsDir() {
+		return []FileInfo{{LocalPath: req.Path, RemotePath: remoteRoot, Size: info.Size(), ModTime: info.ModTime()}}, nil
+	}
+
+	keepStructure := req.KeepStructure == nil || *req.KeepStructure
+	files, _, err := collectFiles(req.Path, req.Exclude, keepStructure)
+	if err != nil {
+		return nil, fmt.Errorf("收集文件失败: %v", err)
+	}
+	// collectFiles 使用文件夹名作为远程根目录，替换为请求中的远程路径
+	folderName := filepath.Base(req.Path)
+	for i := range files {
+		files[i].RemotePath = path.Join(remoteRoot, strings.TrimPrefix(files[i].RemotePath, folderName+"/"))
+	}
+	if !req.Sync {
+		return files, nil
+	}
+
+	remote, err := listRemoteFiles(ctx, resolveRemotePath(config.AppPath, remoteRoot))
+	if err != nil {
+		return nil, fmt.Errorf("对比远程文件失败: %w", err)
+	}
+	plan, err := planSync(ctx, config, files, remote, &SyncOptions{Checksum: req.Checksum})
+	if err != nil {
+		return nil, fmt.Errorf("对比远程文件失败: %w", err)
+	}
+	logger.Info("同步对比: 新增 %d, 修改 %d, 未变化 %d", len(plan.Added), len(plan.Changed), plan.Unchanged)
+	return plan.Uploads(), nil
+}
+
+// 执行上传任务，ctx取消时不再开始新的文件
+func (s *jobServer) run(ctx context.Context, job *Job) error {
+	now := time.Now()
+	job.mu.Lock()
+	req := job.status.Request
+	job.status.State = JobRunning
+	job.status.StartedAt = &now
+	job.mu.Unlock()
+	logger.Info("开始任务 %s: %s", job.status.ID, req.Path)
+
+	config, err := s.jobConfig()
+	if err != nil {
+		return err
+	}
+	files, err := s.collectJobFiles(ctx, config, req)
+	if err != nil {
+		return err
+	}
+
+	stats := &UploadStats{TotalFiles: int64(len(files)), StartTime: now}
+	for _, f := range files {
+		stats.TotalSize += f.Size
+	}
+	atomic.StoreInt64(&job.uploaded, 0)
+	job.mu.Lock()
+	job.stats = stats
+	job.mu.Unlock()
+
+	opts := *s.opts
+	opts.Overwrite = req.Overwrite || req.Sync
+	opts.OnProgress = func(localPath string, n int64) {
+		atomic.AddInt64(&job.uploaded, n)
+	}
+
+	pool := newUploadPool(ctx, config, s.files, s.cacheDir, &opts, stats)
+	for _, f := range files {
+		if !pool.submit(f) {
+			break
+		}
+	}
+	pool.wait()
+	flushFileIndex()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed := atomic.LoadInt64(&stats.FailedFiles); failed > 0 {
+		return fmt.Errorf("有 %d 个文件上传失败", failed)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// 校验 Authorization: Bearer <token>，POST请求还必须是JSON，
+// 这样网页无法通过不需要预检的跨域请求（如text/plain的POST）提交任务
+func (s *jobServer) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bddisk_uploader"`)
+			writeJSONError(w, http.StatusUnauthorized, errors.New("缺少或错误的访问token"))
+			return
+		}
+		if r.Method == http.MethodPost {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeJSONError(w, http.StatusUnsupportedMediaType, errors.New("请求的Content-Type必须为application/json"))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// POST /jobs 创建任务，GET /jobs 列出任务
+func (s *jobServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.list())
+	case http.MethodPost:
+		var req JobRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJobRequestSize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, fmt.Errorf("请求格式错误: %v", err))
+			return
+		}
+		if err := normalizeJobRequest(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		job := s.add(req)
+		writeJSON(w, http.StatusCreated, job.snapshot())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("不支持的请求方法"))
+	}
+}
+
+// GET /jobs/{id} 查询任务，POST /jobs/{id}/cancel|pause|resume 控制任务
+func (s *jobServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, action := strings.TrimPrefix(r.URL.Path, "/jobs/"), ""
+	if i := strings.Index(id, "/"); i >= 0 {
+		id, action = id[:i], id[i+1:]
+	}
+	job := s.get(id)
+	if job == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("任务不存在: %s", id))
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			writeJSONError(w, http.StatusMethodNotAllowed, errors.New("不支持的请求方法"))
+			return
+		}
+		writeJSON(w, http.StatusOK, job.snapshot())
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, errors.New("不支持的请求方法"))
+		return
+	}
+
+	var err error
+	switch action {
+	case "cancel":
+		err = s.stop(job, JobCanceled)
+	case "pause":
+		err = s.stop(job, JobPaused)
+	case "resume":
+		err = s.resume(job)
+	default:
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("不支持的操作: %s", action))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job.snapshot())
+}
+
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("listen", DefaultServeAddr, "HTTP接口监听地址")
+	cacheDir := fs.String("cache-dir", "", "缓存目录（默认使用当前目录下的.chunks）")
+	jobs := fs.Int("jobs", 2, "同时运行的任务数")
+	concurrent := fs.Int("concurrent", 3, "单个任务同时上传的文件数")
+	partConcurrent := fs.Int("part-concurrent", 1, "单个文件同时上传的分片数")
+	maxConnections := fs.Int("max-connections", 8, "所有文件同时上传的分片总数上限（0表示不限制）")
+	chunkSizeMB := fs.Int("chunk-size", 0, "分片大小，单位MB（默认使用账号允许的最大分片）")
+	noRapid := fs.Bool("no-rapid", false, "不尝试秒传，直接分片上传")
+	config, err := setupRemoteCommand(fs, args)
+	if err != nil {
+		return commandFailed(context.Background(), err)
+	}
+	if *jobs < 1 || *concurrent < 1 {
+		return commandFailed(context.Background(), errors.New("-jobs 和 -concurrent 必须大于0"))
+	}
+
+	actualCacheDir, err := getCacheDir(*cacheDir)
+	if err != nil {
+		return commandFailed(context.Background(), fmt.Errorf("获取缓存目录失败: %v", err))
+	}
+	cleanupStaleChunks(actualCacheDir)
+	fileIndex = loadFileIndex(actualCacheDir)
+	defer flushFileIndex()
+
+	ctx, stop := remoteCommandContext()
+	defer stop()
+
+	opts := newUploadOptions(*partConcurrent, *maxConnections, !*noRapid)
+	limits, err := queryAccountLimits(ctx)
+	if err != nil {
+		return commandFailed(ctx, err)
+	}
+	if opts.ChunkSize, err = resolveChunkSize(limits, *chunkSizeMB); err != nil {
+		return commandFailed(ctx, fmt.Errorf("分片大小无效: %v", err))
+	}
+	opts.MaxFileSize = limits.MaxFileSize
+	opts.AccountName = limits.Name
+
+	token := config.ServeToken
+	if token == "" {
+		if token, err = newServeToken(); err != nil {
+			return commandFailed(ctx, err)
+		}
+		logger.Info("未设置serve_token，本次使用随机生成的访问token: %s（使用 config set serve_token <值> 固定）", token)
+	}
+	s := &jobServer{
+		ctx:      ctx,
+		config:   config,
+		token:    token,
+		cacheDir: actualCacheDir,
+		opts:     opts,
+		files:    *concurrent,
+		slots:    make(chan struct{}, *jobs),
+		jobs:     make(map[string]*Job),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", s.authorize(s.handleJobs))
+	mux.HandleFunc("/jobs/", s.authorize(s.handleJob))
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return commandFailed(ctx, fmt.Errorf("监听 %s 失败: %v", *addr, err))
+	}
+	if host, _, _ := net.SplitHostPort(*addr); host == "" || (host != "localhost" && !net.ParseIP(host).IsLoopback()) {
+		logger.Warn("接口使用HTTP明文传输，监听在非本机地址 %s 时访问token可能被截获", *addr)
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("上传服务已启动: http://%s（账号类型: %s，分片大小: %s）", listener.Addr(), limits.Name, formatFileSize(opts.ChunkSize))
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return commandFailed(ctx, err)
+	}
+
+	// 等待正在运行的任务停止，未完成的文件下次上传时可继续
+	s.wg.Wait()
+	logger.Info("上传服务已停止")
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServeAuthorize(t *testing.T) {
+	s := &jobServer{token: "secret", jobs: make(map[string]*Job)}
+	handler := s.authorize(s.handleJobs)
+
+	for _, tc := range []struct {
+		name, method, auth, contentType string
+		status                          int
+	}{
+		{"no token", http.MethodGet, "", "", http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "Bearer other", "", http.StatusUnauthorized},
+		{"not bearer", http.MethodGet, "secret", "", http.StatusUnauthorized},
+		{"list", http.MethodGet, "Bearer secret", "", http.StatusOK},
+		// 网页可以不经预检发送text/plain的跨域POST
+		{"text/plain post", http.MethodPost, "Bearer secret", "text/plain", http.StatusUnsupportedMediaType},
+		{"post without content type", http.MethodPost, "Bearer secret", "", http.StatusUnsupportedMediaType},
+		{"json post", http.MethodPost, "Bearer secret", "application/json; charset=utf-8", http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(tc.method, "/jobs", strings.NewReader(`{"path":""}`))
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s: status = %d, want %d (%s)", tc.name, w.Code, tc.status, w.Body.String())
+		}
+	}
+}
+
+func TestServeResumeOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// 没有空闲的运行名额，启动的任务一直排队
+	s := &jobServer{ctx: ctx, slots: make(chan struct{}), jobs: make(map[string]*Job)}
+	job := &Job{status: JobStatus{ID: "job", State: JobPaused}}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- s.resume(job)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	started := 0
+	for err := range errs {
+		if err == nil {
+			started++
+		}
+	}
+	if started != 1 {
+		t.Errorf("concurrent resume started the job %d times, want 1", started)
+	}
+	if state := job.snapshot().State; state != JobQueued {
+		t.Errorf("state = %s, want %s", state, JobQueued)
+	}
+
+	cancel()
+	s.wg.Wait()
+	if err := s.resume(&Job{status: JobStatus{State: JobCompleted}}); err == nil {
+		t.Error("resuming a completed job should fail")
+	}
+}
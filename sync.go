@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"bddisk_uploader/logger"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+)
+
+// 同步选项，文件夹上传时只上传新增或修改过的文件
+type SyncOptions struct {
+	Checksum  bool        // 大小相同但修改时间不同时比较MD5，而不是直接视为已修改
+	DryRun    bool        // 只输出同步计划，不上传也不删除
+	Mirror    bool        // 删除远程多余的文件，使远程目录与本地一致
+	Trash     bool        // 镜像模式下将多余的文件移动到回收目录，而不是直接删除
+	MaxDelete DeleteLimit // 镜像模式下单次最多删除的文件数
+	Exclude   []string    // 排除模式，匹配的远程文件不会被删除
+}
+
+// 本地文件与远程文件的对比结果
+type SyncPlan struct {
+	Added       []FileInfo // 远程不存在的文件
+	Changed     []FileInfo // 远程存在但内容可能不同的文件
+	Unchanged   int
+	Deletes     []MirrorDelete // 镜像模式下需要删除的远程文件和目录
+	RemoteFiles int            // 远程目录中的文件总数
+}
+
+// 需要上传的文件
+func (p *SyncPlan) Uploads() []FileInfo {
+	files := make([]FileInfo, 0, len(p.Added)+len(p.Changed))
+	files = append(files, p.Added...)
+	return append(files, p.Changed...)
+}
+
+// 文件夹对应的远程目录，与 collectFiles 生成的远程路径一致
+func remoteFolderPath(config *Config, folderPath string) string {
+	return resolveRemotePath(config.AppPath, filepath.Base(folderPath))
+}
+
+// 列出远程目录下的所有文件，目录不存在时返回空列表
+func listRemoteFiles(ctx context.Context, remoteDir string) (map[string]file.FileEntry, error) {
+	entries, err := listAllRecursive(ctx, remoteDir)
+	if errors.Is(err, errno.ErrFileNotFound) {
+		return map[string]file.FileEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	remote := make(map[string]file.FileEntry, len(entries))
+	for _, e := range entries {
+		remote[e.Path] = e
+	}
+	return remote, nil
+}
+
+// 对比本地文件与远程文件：大小不同视为已修改；大小相同时比较修改时间，开启Checksum时再比较MD5
+func planSync(ctx context.Context, config *Config, files []FileInfo, remote map[string]file.FileEntry, opts *SyncOptions) (*SyncPlan, error) {
+	plan := &SyncPlan{}
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		remotePath := resolveRemotePath(config.AppPath, f.RemotePath)
+		e, ok := remote[remotePath]
+		switch {
+		case !ok || e.IsDir():
+			plan.Added = append(plan.Added, f)
+		case int64(e.Size) != f.Size:
+			plan.Changed = append(plan.Changed, f)
+		case e.LocalMtime == f.ModTime.Unix(), uploadedUnchanged(f.LocalPath, remotePath, e.FsId):
+			plan.Unchanged++
+		case opts.Checksum && e.Md5 != "":
+			sum, err := contentMD5WithIndex(f.LocalPath)
+			if err != nil {
+				return nil, fmt.Errorf("计算文件MD5失败 %s: %v", f.LocalPath, err)
+			}
+			if strings.EqualFold(sum, e.Md5) {
+				plan.Unchanged++
+			} else {
+				plan.Changed = append(plan.Changed, f)
+			}
+		default:
+			plan.Changed = append(plan.Changed, f)
+		}
+	}
+	return plan, nil
+}
+
+// 列出远程目录并与本地文件对比，返回同步计划；本地有unreadable个路径无法访问时不清理远程文件
+func buildSyncPlan(ctx context.Context, config *Config, folderPath string, files []FileInfo, unreadable int, opts *SyncOptions) (*SyncPlan, error) {
+	remoteDir := remoteFolderPath(config, folderPath)
+	logger.Info("正在列出远程目录: %s", remoteDir)
+	remote, err := listRemoteFiles(ctx, remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("远程共 %d 个文件和目录，正在对比...", len(remote))
+
+	plan, err := planSync(ctx, config, files, remote, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Mirror {
+		fmt.Printf("同步对比: 新增 %d, 修改 %d, 未变化 %d\n", len(plan.Added), len(plan.Changed), plan.Unchanged)
+		return plan, nil
+	}
+	// 无法访问的文件会被误认为本地已删除，这次只上传不清理
+	if unreadable > 0 {
+		fmt.Printf("同步对比: 新增 %d, 修改 %d, 未变化 %d\n", len(plan.Added), len(plan.Changed), plan.Unchanged)
+		logger.Warn("扫描本地文件夹时有 %d 个文件或目录无法访问，跳过清理远程多余的文件", unreadable)
+		return plan, nil
+	}
+
+	plan.Deletes = planMirrorDeletes(config, remoteDir, files, remote, opts.Exclude)
+	for _, e := range remote {
+		if !e.IsDir() {
+			plan.RemoteFiles++
+		}
+	}
+	deleteFiles := plan.DeleteFiles()
+	fmt.Printf("同步对比: 新增 %d, 修改 %d, 未变化 %d, 远程多余 %d\n", len(plan.Added), len(plan.Changed), plan.Unchanged, deleteFiles)
+
+	if !opts.MaxDelete.Allows(deleteFiles, plan.RemoteFiles) {
+		err := fmt.Errorf("需要删除 %d 个远程文件（共 %d 个），超过 -max-delete %s 的限制，请确认后调大该参数", deleteFiles, plan.RemoteFiles, opts.MaxDelete)
+		if !opts.DryRun {
+			return nil, err
+		}
+		logger.Warn("%v", err)
+	}
+	return plan, nil
+}
+
+// 输出演练模式下的同步计划
+func printSyncPlan(config *Config, plan *SyncPlan, opts *SyncOptions) {
+	var uploadSize int64
+	for _, f := range plan.Added {
+		uploadSize += f.Size
+		fmt.Printf("  + 新增: %s (%s)\n", resolveRemotePath(config.AppPath, f.RemotePath), formatFileSize(f.Size))
+	}
+	for _, f := range plan.Changed {
+		uploadSize += f.Size
+		fmt.Printf("  ~ 修改: %s (%s)\n", resolveRemotePath(config.AppPath, f.RemotePath), formatFileSize(f.Size))
+	}
+
+	action := "删除"
+	if opts.Trash {
+		action = "移到回收目录"
+	}
+	for _, d := range plan.Deletes {
+		if d.IsDir {
+			fmt.Printf("  - %s: %s/ (%d 个文件, %s)\n", action, d.Path, d.Files, formatFileSize(d.Size))
+		} else {
+			fmt.Printf("  - %s: %s (%s)\n", action, d.Path, formatFileSize(d.Size))
+		}
+	}
+
+	fmt.Printf("\n演练模式，未做任何修改: 将上传 %d 个文件 (%s)", len(plan.Added)+len(plan.Changed), formatFileSize(uploadSize))
+	if opts.Mirror {
+		fmt.Printf("，%s %d 个远程文件", action, plan.DeleteFiles())
+	}
+	fmt.Println()
+}
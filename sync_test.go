@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+)
+
+// 创建本地文件，返回对应的FileInfo
+func writeSyncFile(t *testing.T, dir, name, content string) FileInfo {
+	t.Helper()
+	localPath := filepath.Join(dir, name)
+	if err := os.WriteFile(localPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FileInfo{LocalPath: localPath, RemotePath: "docs/" + name, Size: info.Size(), ModTime: info.ModTime()}
+}
+
+func TestPlanSync(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{AppPath: "/apps/test/"}
+	added := writeSyncFile(t, dir, "added.txt", "new")
+	resized := writeSyncFile(t, dir, "resized.txt", "longer")
+	sameMtime := writeSyncFile(t, dir, "same.txt", "same")
+	touched := writeSyncFile(t, dir, "touched.txt", "hello")
+	sameMD5 := writeSyncFile(t, dir, "md5.txt", "hello")
+	otherMD5 := writeSyncFile(t, dir, "other.txt", "world")
+	overDir := writeSyncFile(t, dir, "dir.txt", "x")
+
+	older := time.Now().Add(-time.Hour).Unix()
+	remote := map[string]file.FileEntry{
+		"/apps/test/docs/resized.txt": {Size: 3, LocalMtime: resized.ModTime.Unix()},
+		"/apps/test/docs/same.txt":    {Size: 4, LocalMtime: sameMtime.ModTime.Unix()},
+		"/apps/test/docs/touched.txt": {Size: 5, LocalMtime: older},
+		"/apps/test/docs/md5.txt":     {Size: 5, LocalMtime: older, Md5: "5D41402ABC4B2A76B9719D911017C592"},
+		"/apps/test/docs/other.txt":   {Size: 5, LocalMtime: older, Md5: "5d41402abc4b2a76b9719d911017c592"},
+		"/apps/test/docs/dir.txt":     {Isdir: 1},
+	}
+	files := []FileInfo{added, resized, sameMtime, touched, sameMD5, otherMD5, overDir}
+
+	// 不比较MD5时修改时间不同即视为已修改
+	plan, err := planSync(context.Background(), config, files, remote, &SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSyncFiles(t, "Added", plan.Added, added, overDir)
+	assertSyncFiles(t, "Changed", plan.Changed, resized, touched, sameMD5, otherMD5)
+	if plan.Unchanged != 1 {
+		t.Errorf("Unchanged = %d, want 1", plan.Unchanged)
+	}
+
+	plan, err = planSync(context.Background(), config, files, remote, &SyncOptions{Checksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSyncFiles(t, "Added", plan.Added, added, overDir)
+	assertSyncFiles(t, "Changed", plan.Changed, resized, touched, otherMD5)
+	if plan.Unchanged != 2 {
+		t.Errorf("Unchanged = %d, want 2", plan.Unchanged)
+	}
+	if uploads := plan.Uploads(); len(uploads) != 5 {
+		t.Errorf("Uploads = %d files, want 5", len(uploads))
+	}
+}
+
+func TestPlanSyncCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	files := []FileInfo{{LocalPath: "a", RemotePath: "docs/a"}}
+	if _, err := planSync(ctx, &Config{AppPath: "/apps/test/"}, files, nil, &SyncOptions{}); err != context.Canceled {
+		t.Errorf("planSync error = %v, want context.Canceled", err)
+	}
+}
+
+func assertSyncFiles(t *testing.T, name string, got []FileInfo, want ...FileInfo) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", name, got, want)
+		return
+	}
+	for i := range want {
+		if got[i].LocalPath != want[i].LocalPath {
+			t.Errorf("%s[%d] = %s, want %s", name, i, got[i].LocalPath, want[i].LocalPath)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"bddisk_uploader/logger"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+)
+
+const (
+	TokenRefreshAhead  = 10 * time.Minute // access_token过期前多久开始刷新
+	minRefreshInterval = time.Minute      // 刷新后仍然提示token无效时，两次刷新的最小间隔
+)
+
+// 所有接口调用共用的access_token，加载配置后由 initSDKClients 重新创建
+var tokens = &tokenSource{}
+
+// access_token的来源：即将过期时提前刷新，接口返回token无效时刷新一次，
+// 新的token会保存到凭据存储。不修改Config，避免与上传中读取配置的协程竞争
+type tokenSource struct {
+	mu           sync.Mutex
+	oauth        *OAuthConfig
+	accessToken  string
+	refreshToken string
+	expiresAt    *time.Time
+	refreshedAt  time.Time
+}
+
+func newTokenSource(config *Config) *tokenSource {
+	return &tokenSource{
+		oauth:        config.OAuth,
+		accessToken:  config.AccessToken,
+		refreshToken: config.RefreshToken,
+		expiresAt:    config.ExpiresAt,
+	}
+}
+
+// 返回当前可用的access_token，即将过期时先刷新；
+// 刷新失败但token尚未过期时继续使用旧的token
+func (ts *tokenSource) token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.expiresAt == nil || time.Until(*ts.expiresAt) > TokenRefreshAhead {
+		return ts.accessToken, nil
+	}
+	expired := !time.Now().Before(*ts.expiresAt)
+	if expired {
+		logger.Warn("access_token已过期，尝试自动刷新...")
+	} else {
+		logger.Info("access_token即将过期，自动刷新...")
+	}
+	if err := ts.refresh(); err != nil {
+		if expired {
+			return "", fmt.Errorf("自动刷新token失败: %v", err)
+		}
+		logger.Warn("自动刷新token失败，继续使用当前token: %v", err)
+	}
+	return ts.accessToken, nil
+}
+
+// 接口返回token无效时调用：stale仍是当前token时刷新，
+// 已被其他请求刷新过则直接返回新的token
+func (ts *tokenSource) refreshAfter(stale string) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.accessToken != stale {
+		return ts.accessToken, nil
+	}
+	if time.Since(ts.refreshedAt) < minRefreshInterval {
+		return "", fmt.Errorf("刚刷新的token仍然无效")
+	}
+	logger.Warn("access_token已失效，尝试自动刷新...")
+	if err := ts.refresh(); err != nil {
+		return "", err
+	}
+	return ts.accessToken, nil
+}
+
+// 使用refresh_token刷新并保存到凭据存储，调用方需持有锁。
+// 刷新时持有凭据文件的锁，其他进程已经刷新过时直接使用存储中的新token，
+// 避免多个进程用同一个refresh_token重复刷新
+func (ts *tokenSource) refresh() error {
+	if ts.refreshToken == "" || ts.oauth == nil {
+		return fmt.Errorf("配置文件中没有refresh_token或OAuth信息")
+	}
+
+	var tokenResp *TokenResponse
+	cred, err := updateStoredToken(func(stored *Credentials) (*TokenResponse, error) {
+		if stored.AccessToken != "" && stored.AccessToken != ts.accessToken &&
+			(stored.ExpiresAt == nil || time.Until(*stored.ExpiresAt) > TokenRefreshAhead) {
+			return nil, nil
+		}
+		refreshToken := ts.refreshToken
+		if stored.RefreshToken != "" {
+			refreshToken = stored.RefreshToken
+		}
+		var err error
+		tokenResp, err = refreshAccessToken(ts.oauth, refreshToken)
+		return tokenResp, err
+	})
+	switch {
+	case err != nil && tokenResp != nil:
+		// 旧的refresh_token已经失效，保存失败时新token仍在本次运行中使用
+		logger.Warn("保存新token失败，新token只在本次运行中使用: %v", err)
+	case errors.Is(err, os.ErrNotExist):
+		// 只通过环境变量配置时没有配置文件
+		if tokenResp, err = refreshAccessToken(ts.oauth, ts.refreshToken); err != nil {
+			return err
+		}
+		logger.Warn("没有配置文件，新token只在本次运行中使用")
+	case err != nil:
+		return err
+	}
+	if tokenResp != nil {
+		cred = &Credentials{RefreshToken: ts.refreshToken}
+		cred.setToken(tokenResp)
+	}
+
+	ts.accessToken = cred.AccessToken
+	if cred.RefreshToken != "" {
+		ts.refreshToken = cred.RefreshToken
+	}
+	ts.expiresAt = cred.ExpiresAt
+	if tokenResp != nil {
+		ts.refreshedAt = time.Now()
+		logger.Info("access_token已自动刷新")
+	} else {
+		logger.Info("已使用其他进程刷新的access_token")
+	}
+	return nil
+}
+
+// 判断是否为access_token无效或过期的错误
+func isTokenError(err error) bool {
+	return errors.Is(err, errno.ErrTokenInvalid) || errors.Is(err, errno.ErrTokenExpired)
+}
+
+// 使用access_token调用接口，返回token无效或过期时刷新一次并重试
+func withToken(call func(accessToken string) error) error {
+	accessToken, err := tokens.token()
+	if err != nil {
+		return err
+	}
+	err = call(accessToken)
+	if !isTokenError(err) {
+		return err
+	}
+
+	newToken, refreshErr := tokens.refreshAfter(accessToken)
+	if refreshErr != nil {
+		return fmt.Errorf("%w（自动刷新token失败: %v）", err, refreshErr)
+	}
+	return call(newToken)
+}
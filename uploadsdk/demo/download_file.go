@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/download"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+)
+
+func main() {
+	// 使用示例
+
+	// 用户的access_token
+	accessToken := "your-access-token"
+
+	// 要下载的文件的fs_id，可以通过 file.List 获取
+	var fsId uint64 = 123456789
+
+	// call filemetas API，获取下载地址
+	metas, err := file.FileMetas(accessToken, file.NewFileMetasArg([]uint64{fsId}, true))
+	if err != nil || len(metas.List) == 0 {
+		fmt.Printf("[msg: filemetas error] [err:%v]", err)
+		return
+	}
+
+	// 下载前1MB
+	ret, err := download.Download(accessToken, download.NewDownloadArg(metas.List[0].Dlink, 0, 1024*1024))
+	if err != nil {
+		fmt.Printf("[msg: download error] [err:%v]", err.Error())
+		return
+	}
+	defer ret.Body.Close()
+
+	n, err := io.Copy(os.Stdout, ret.Body)
+	fmt.Printf("\n[msg: download done] [bytes:%d] [total:%d] [err:%v]\n", n, ret.TotalSize, err)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/file"
+)
+
+func main() {
+	// 使用示例
+
+	// 用户的access_token
+	accessToken := "your-access-token"
+
+	// 要列出的目录
+	dir := "/apps/hhhkoo"
+
+	// call list API，从第0个开始，最多返回100个
+	arg := file.NewListArg(dir, 0, 100)
+	if ret, err := file.List(accessToken, arg); err != nil {
+		fmt.Printf("[msg: list error] [err:%v]", err.Error())
+	} else {
+		for _, entry := range ret.List {
+			fmt.Printf("%s\t%d\n", entry.Path, entry.Size)
+		}
+	}
+}
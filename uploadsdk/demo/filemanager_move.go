@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/filemanager"
+)
+
+func main() {
+	// 使用示例
+
+	// 用户的access_token
+	accessToken := "your-access-token"
+
+	// 将 testfile.pdf 移动到 backup 目录下并重命名
+	fileList := []filemanager.CopyItem{
+		{Path: "/apps/hhhkoo/testfile.pdf", Dest: "/apps/hhhkoo/backup", Newname: "testfile-old.pdf"},
+	}
+
+	// call filemanager API，同步执行，目标已存在时返回失败
+	arg := filemanager.NewMoveArg(fileList, filemanager.AsyncSync, filemanager.OndupFail)
+	if ret, err := filemanager.Move(accessToken, arg); err != nil {
+		fmt.Printf("[msg: move error] [err:%v] [info:%+v]", err.Error(), ret.Info)
+	} else {
+		fmt.Printf("ret:%+v", ret)
+	}
+}
@@ -0,0 +1,105 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// 下载dlink时必须使用的User-Agent
+const UserAgent = "pan.baidu.com"
+
+// Download 通过dlink下载文件，Offset/Length 不为默认值时使用HTTP Range请求部分内容。
+// dlink 通过 file.FileMetas 获取（Dlink 参数为true），有效期8小时
+//
+// RETURNS:
+//   - DownloadReturn: download return，Body 需要调用方关闭
+//   - error: the return error if any occurs
+func Download(accessToken string, arg *DownloadArg) (DownloadReturn, error) {
+	return defaultClient.Download(accessToken, arg)
+}
+
+// DownloadWithContext 同 Download，ctx取消时中止请求
+func DownloadWithContext(ctx context.Context, accessToken string, arg *DownloadArg) (DownloadReturn, error) {
+	return defaultClient.DownloadWithContext(ctx, accessToken, arg)
+}
+
+// Download 使用客户端配置下载文件
+func (c *Client) Download(accessToken string, arg *DownloadArg) (DownloadReturn, error) {
+	return c.DownloadWithContext(context.Background(), accessToken, arg)
+}
+
+// DownloadWithContext 使用客户端配置下载文件，ctx取消时中止请求
+func (c *Client) DownloadWithContext(ctx context.Context, accessToken string, arg *DownloadArg) (DownloadReturn, error) {
+	ret := DownloadReturn{ContentLength: -1, TotalSize: -1}
+
+	if arg.Dlink == "" {
+		return ret, errors.New("dlink is empty")
+	}
+	uri, err := url.Parse(arg.Dlink)
+	if err != nil {
+		return ret, fmt.Errorf("parse dlink failed: %v", err)
+	}
+	params := uri.Query()
+	params.Set("access_token", accessToken)
+	uri.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return ret, utils.RedactError(err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if arg.Offset > 0 || arg.Length > 0 {
+		end := ""
+		if arg.Length > 0 {
+			end = strconv.FormatInt(arg.Offset+arg.Length-1, 10)
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%s", arg.Offset, end))
+	}
+
+	resp, err := c.DownloadHTTPClient.Do(req)
+	if err != nil {
+		return ret, utils.RedactError(err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if err = errno.Check("download", resp.StatusCode, body); err != nil {
+			return ret, err
+		}
+		return ret, fmt.Errorf("download failed: http_status=%d", resp.StatusCode)
+	}
+
+	ret.Body = resp.Body
+	ret.StatusCode = resp.StatusCode
+	ret.ContentLength = resp.ContentLength
+	ret.Partial = resp.StatusCode == http.StatusPartialContent
+	if ret.Partial {
+		ret.TotalSize = parseContentRangeTotal(resp.Header.Get("Content-Range"))
+	} else {
+		ret.TotalSize = resp.ContentLength
+	}
+	return ret, nil
+}
+
+// 解析 "bytes 0-99/1000" 中的文件总大小
+func parseContentRangeTotal(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
@@ -0,0 +1,28 @@
+package download
+
+import "io"
+
+// 下载参数
+type DownloadArg struct {
+	Dlink  string // filemetas 返回的下载地址
+	Offset int64  // 起始位置
+	Length int64  // 下载长度，小于等于0表示下载到文件末尾
+}
+
+// 创建 DownloadArg 实例
+func NewDownloadArg(dlink string, offset int64, length int64) *DownloadArg {
+	s := new(DownloadArg)
+	s.Dlink = dlink
+	s.Offset = offset
+	s.Length = length
+	return s
+}
+
+// DownloadReturn 下载结果，调用方读取完 Body 后需要关闭
+type DownloadReturn struct {
+	Body          io.ReadCloser
+	StatusCode    int
+	ContentLength int64 // 本次响应的数据长度，未知时为-1
+	TotalSize     int64 // 文件总大小，服务端未返回时为-1
+	Partial       bool  // 服务端是否按Range返回了部分内容
+}
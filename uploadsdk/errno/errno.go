@@ -0,0 +1,150 @@
+package errno
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// 可通过 errors.Is 判断的错误类型
+var (
+	ErrInvalidParam     = errors.New("invalid parameter")
+	ErrTokenInvalid     = errors.New("access token invalid")
+	ErrTokenExpired     = errors.New("access token expired")
+	ErrNoPermission     = errors.New("no permission")
+	ErrPathIllegal      = errors.New("path illegal")
+	ErrFileExists       = errors.New("file already exists")
+	ErrFileNotFound     = errors.New("file not found")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrFileTooLarge     = errors.New("file too large")
+	ErrPartTooLarge     = errors.New("part too large")
+	ErrPartMissing      = errors.New("part missing")
+	ErrFrequencyControl = errors.New("frequency control")
+	ErrCreateFailed     = errors.New("create file failed")
+	ErrBatchFailed      = errors.New("batch operation failed")
+	ErrRapidUploadMiss  = errors.New("rapid upload miss")
+)
+
+// 已知错误码
+type known struct {
+	sentinel error
+	message  string
+}
+
+var knownErrnos = map[int]known{
+	2:     {ErrInvalidParam, "参数错误"},
+	6:     {ErrNoPermission, "不允许接入用户数据"},
+	10:    {ErrCreateFailed, "创建文件失败"},
+	12:    {ErrBatchFailed, "批量操作失败"},
+	-6:    {ErrTokenInvalid, "身份验证失败"},
+	-7:    {ErrPathIllegal, "文件或目录名错误或无权访问"},
+	-8:    {ErrFileExists, "文件或目录已存在"},
+	-9:    {ErrFileNotFound, "文件或目录不存在"},
+	-10:   {ErrQuotaExceeded, "云端容量已满"},
+	110:   {ErrTokenInvalid, "access token 无效"},
+	111:   {ErrTokenExpired, "access token 已过期"},
+	31023: {ErrInvalidParam, "参数错误"},
+	31024: {ErrNoPermission, "没有访问权限"},
+	31034: {ErrFrequencyControl, "命中接口频控"},
+	31045: {ErrTokenInvalid, "access_token验证未通过"},
+	31061: {ErrFileExists, "文件已存在"},
+	31062: {ErrPathIllegal, "文件名非法"},
+	31064: {ErrPathIllegal, "上传路径错误或无权访问"},
+	31066: {ErrFileNotFound, "文件不存在"},
+	31079: {ErrRapidUploadMiss, "未找到文件MD5"},
+	31363: {ErrPartMissing, "分片缺失"},
+	31364: {ErrPartTooLarge, "超出分片大小限制"},
+	31365: {ErrFileTooLarge, "文件总大小超限"},
+}
+
+// APIError 百度网盘开放接口返回的错误
+type APIError struct {
+	Errno      int    // 接口返回的errno/error_code
+	Method     string // 接口方法，如 precreate、superfile2
+	HTTPStatus int    // HTTP状态码
+	RequestID  string // 接口返回的request_id
+	Message    string // 接口返回的错误信息，为空时使用已知错误码的描述
+	Kind       error  // 可选，调用方根据接口含义指定的错误类型，优先于错误码对应的 ErrXxx
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = Message(e.Errno)
+	}
+	s := fmt.Sprintf("call %s failed: errno=%d", e.Method, e.Errno)
+	if msg != "" {
+		s += " (" + msg + ")"
+	}
+	if e.HTTPStatus != 0 && e.HTTPStatus != http.StatusOK {
+		s += fmt.Sprintf(", http_status=%d", e.HTTPStatus)
+	}
+	if e.RequestID != "" {
+		s += ", request_id=" + e.RequestID
+	}
+	return s
+}
+
+// Unwrap 返回错误码对应的 ErrXxx，使 errors.Is 可以直接判断错误类型
+func (e *APIError) Unwrap() error {
+	if e.Kind != nil {
+		return e.Kind
+	}
+	if k, ok := knownErrnos[e.Errno]; ok {
+		return k.sentinel
+	}
+	return nil
+}
+
+// Temporary 判断错误是否为频控或服务端临时错误，可以稍后重试
+func (e *APIError) Temporary() bool {
+	return e.Errno == 31034 || e.HTTPStatus >= 500
+}
+
+// Message 返回已知错误码的中文描述，未知错误码返回空字符串
+func Message(errno int) string {
+	return knownErrnos[errno].message
+}
+
+// 接口响应中与错误相关的字段，xpan接口使用errno，pcs接口使用error_code
+type errorBody struct {
+	Errno     *int        `json:"errno"`
+	ErrorCode *int        `json:"error_code"`
+	ErrMsg    string      `json:"errmsg"`
+	ErrorMsg  string      `json:"error_msg"`
+	RequestID json.Number `json:"request_id"`
+}
+
+// Check 检查接口响应，errno不为0或HTTP状态码异常时返回 *APIError
+func Check(method string, httpStatus int, body []byte) error {
+	var eb errorBody
+	parsed := json.Unmarshal(body, &eb) == nil
+
+	code := 0
+	switch {
+	case eb.Errno != nil:
+		code = *eb.Errno
+	case eb.ErrorCode != nil:
+		code = *eb.ErrorCode
+	}
+	// 非JSON的成功响应交给调用方解析
+	if code == 0 && httpStatus < 400 {
+		return nil
+	}
+
+	msg := eb.ErrMsg
+	if msg == "" {
+		msg = eb.ErrorMsg
+	}
+	if !parsed && msg == "" {
+		msg = http.StatusText(httpStatus)
+	}
+	return &APIError{
+		Errno:      code,
+		Method:     method,
+		HTTPStatus: httpStatus,
+		RequestID:  eb.RequestID.String(),
+		Message:    msg,
+	}
+}
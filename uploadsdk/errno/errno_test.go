@@ -0,0 +1,75 @@
+package errno_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+)
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		body     string
+		sentinel error
+		errno    int
+		message  string
+	}{
+		{"xpan errno", http.StatusOK, `{"errno":-6,"request_id":123}`, errno.ErrTokenInvalid, -6, ""},
+		{"pcs error_code", http.StatusOK, `{"error_code":31064,"error_msg":"file is not authorized","request_id":456}`, errno.ErrPathIllegal, 31064, "file is not authorized"},
+		{"errmsg", http.StatusOK, `{"errno":2,"errmsg":"param error"}`, errno.ErrInvalidParam, 2, "param error"},
+		{"unknown errno", http.StatusOK, `{"errno":99999}`, nil, 99999, ""},
+		{"http error with errno 0", http.StatusInternalServerError, `{"errno":0}`, nil, 0, ""},
+		{"non-json http error", http.StatusBadGateway, `<html>bad gateway</html>`, nil, 0, "Bad Gateway"},
+	} {
+		err := errno.Check("test", tc.status, []byte(tc.body))
+		var apiErr *errno.APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: Check = %v, want *APIError", tc.name, err)
+			continue
+		}
+		if apiErr.Errno != tc.errno || apiErr.Method != "test" || apiErr.HTTPStatus != tc.status || apiErr.Message != tc.message {
+			t.Errorf("%s: APIError = %#v", tc.name, apiErr)
+		}
+		if tc.sentinel != nil && !errors.Is(err, tc.sentinel) {
+			t.Errorf("%s: errors.Is(%v, %v) = false", tc.name, err, tc.sentinel)
+		}
+		if tc.sentinel == nil && errors.Unwrap(err) != nil {
+			t.Errorf("%s: Unwrap = %v, want nil", tc.name, errors.Unwrap(err))
+		}
+	}
+}
+
+func TestCheckSuccess(t *testing.T) {
+	for _, body := range []string{`{"errno":0,"list":[]}`, `{"md5":"abc"}`, `not json`} {
+		if err := errno.Check("test", http.StatusOK, []byte(body)); err != nil {
+			t.Errorf("Check(%s) = %v, want nil", body, err)
+		}
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	err := &errno.APIError{Errno: 31034, Method: "precreate", HTTPStatus: http.StatusOK, RequestID: "789"}
+	if msg := err.Error(); !strings.Contains(msg, "errno=31034") || !strings.Contains(msg, "命中接口频控") ||
+		!strings.Contains(msg, "request_id=789") || strings.Contains(msg, "http_status") {
+		t.Errorf("Error() = %q", msg)
+	}
+	if !err.Temporary() || !errors.Is(err, errno.ErrFrequencyControl) {
+		t.Errorf("31034 should be a temporary frequency control error")
+	}
+	if (&errno.APIError{Errno: 1, HTTPStatus: http.StatusServiceUnavailable}).Temporary() != true {
+		t.Error("HTTP 503 should be temporary")
+	}
+
+	// 调用方指定的错误类型优先于错误码表
+	err = &errno.APIError{Errno: 404, Method: "rapidupload", Kind: errno.ErrRapidUploadMiss}
+	if !errors.Is(err, errno.ErrRapidUploadMiss) {
+		t.Error("Kind should be matched by errors.Is")
+	}
+	if errno.Message(404) != "" || errors.Is(&errno.APIError{Errno: 404}, errno.ErrRapidUploadMiss) {
+		t.Error("errno 404 should not be a known errno")
+	}
+}
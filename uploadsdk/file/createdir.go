@@ -0,0 +1,67 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// CreateDir 创建目录，父目录不存在时一并创建。
+// 目录已存在时返回的错误满足 errors.Is(err, errno.ErrFileExists)
+//
+// RETURNS:
+//   - CreateDirReturn: create return
+//   - error: the return error if any occurs
+func CreateDir(accessToken string, arg *CreateDirArg) (CreateDirReturn, error) {
+	return defaultClient.CreateDir(accessToken, arg)
+}
+
+// CreateDirWithContext 同 CreateDir，ctx取消时中止请求
+func CreateDirWithContext(ctx context.Context, accessToken string, arg *CreateDirArg) (CreateDirReturn, error) {
+	return defaultClient.CreateDirWithContext(ctx, accessToken, arg)
+}
+
+// CreateDir 使用客户端配置创建目录
+func (c *Client) CreateDir(accessToken string, arg *CreateDirArg) (CreateDirReturn, error) {
+	return c.CreateDirWithContext(context.Background(), accessToken, arg)
+}
+
+// CreateDirWithContext 使用客户端配置创建目录，ctx取消时中止请求
+func (c *Client) CreateDirWithContext(ctx context.Context, accessToken string, arg *CreateDirArg) (CreateDirReturn, error) {
+	ret := CreateDirReturn{}
+
+	router := "/rest/2.0/xpan/file?method=create&"
+	uri := c.APIURL(router)
+
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	uri += params.Encode()
+
+	postBody := url.Values{}
+	postBody.Add("path", arg.Path)
+	postBody.Add("size", "0")
+	postBody.Add("isdir", "1")
+	// 目录已存在时返回错误，而不是创建重命名的目录
+	postBody.Add("rtype", "0")
+
+	body, status, err := utils.DoHTTPRequestWithClient(ctx, c.APIHTTPClient, uri, strings.NewReader(postBody.Encode()), headers)
+	if err != nil {
+		return ret, err
+	}
+	if err = errno.Check("create", status, []byte(body)); err != nil {
+		return ret, err
+	}
+	if err = json.Unmarshal([]byte(body), &ret); err != nil {
+		return ret, errors.New("unmarshal create body failed")
+	}
+	return ret, nil
+}
@@ -0,0 +1,68 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// FileMetas 根据fs_id批量查询文件元信息，Dlink 为true时同时返回下载地址
+//
+// RETURNS:
+//   - FileMetasReturn: filemetas return
+//   - error: the return error if any occurs
+func FileMetas(accessToken string, arg *FileMetasArg) (FileMetasReturn, error) {
+	return defaultClient.FileMetas(accessToken, arg)
+}
+
+// FileMetasWithContext 同 FileMetas，ctx取消时中止请求
+func FileMetasWithContext(ctx context.Context, accessToken string, arg *FileMetasArg) (FileMetasReturn, error) {
+	return defaultClient.FileMetasWithContext(ctx, accessToken, arg)
+}
+
+// FileMetas 使用客户端配置查询文件元信息
+func (c *Client) FileMetas(accessToken string, arg *FileMetasArg) (FileMetasReturn, error) {
+	return c.FileMetasWithContext(context.Background(), accessToken, arg)
+}
+
+// FileMetasWithContext 使用客户端配置查询文件元信息，ctx取消时中止请求
+func (c *Client) FileMetasWithContext(ctx context.Context, accessToken string, arg *FileMetasArg) (FileMetasReturn, error) {
+	ret := FileMetasReturn{}
+
+	router := "/rest/2.0/xpan/multimedia?method=filemetas&"
+	uri := c.APIURL(router)
+
+	fsIds, _ := json.Marshal(arg.FsIds)
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	params.Set("fsids", string(fsIds))
+	if arg.Dlink {
+		params.Set("dlink", "1")
+	}
+	if arg.Thumb {
+		params.Set("thumb", "1")
+	}
+	if arg.Extra {
+		params.Set("extra", "1")
+	}
+	if arg.NeedMedia {
+		params.Set("needmedia", "1")
+	}
+	uri += params.Encode()
+
+	body, status, err := utils.DoHTTPGetWithClient(ctx, c.APIHTTPClient, uri, nil)
+	if err != nil {
+		return ret, err
+	}
+	if err = errno.Check("filemetas", status, []byte(body)); err != nil {
+		return ret, err
+	}
+	if err = json.Unmarshal([]byte(body), &ret); err != nil {
+		return ret, errors.New("unmarshal filemetas body failed")
+	}
+	return ret, nil
+}
@@ -0,0 +1,129 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// List 获取目录下的文件列表（不递归）
+//
+// RETURNS:
+//   - ListReturn: list return
+//   - error: the return error if any occurs
+func List(accessToken string, arg *ListArg) (ListReturn, error) {
+	return defaultClient.List(accessToken, arg)
+}
+
+// ListWithContext 同 List，ctx取消时中止请求
+func ListWithContext(ctx context.Context, accessToken string, arg *ListArg) (ListReturn, error) {
+	return defaultClient.ListWithContext(ctx, accessToken, arg)
+}
+
+// List 使用客户端配置获取目录下的文件列表
+func (c *Client) List(accessToken string, arg *ListArg) (ListReturn, error) {
+	return c.ListWithContext(context.Background(), accessToken, arg)
+}
+
+// ListWithContext 使用客户端配置获取目录下的文件列表，ctx取消时中止请求
+func (c *Client) ListWithContext(ctx context.Context, accessToken string, arg *ListArg) (ListReturn, error) {
+	ret := ListReturn{}
+
+	router := "/rest/2.0/xpan/file?method=list&"
+	uri := c.APIURL(router)
+
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	params.Set("dir", arg.Dir)
+	if arg.Order != "" {
+		params.Set("order", arg.Order)
+	}
+	if arg.Desc {
+		params.Set("desc", "1")
+	}
+	params.Set("start", strconv.Itoa(arg.Start))
+	if arg.Limit > 0 {
+		params.Set("limit", strconv.Itoa(arg.Limit))
+	}
+	if arg.FolderOnly {
+		params.Set("folder", "1")
+	}
+	if arg.ShowEmpty {
+		params.Set("showempty", "1")
+	}
+	uri += params.Encode()
+
+	body, status, err := utils.DoHTTPGetWithClient(ctx, c.APIHTTPClient, uri, nil)
+	if err != nil {
+		return ret, err
+	}
+	if err = errno.Check("list", status, []byte(body)); err != nil {
+		return ret, err
+	}
+	if err = json.Unmarshal([]byte(body), &ret); err != nil {
+		return ret, errors.New("unmarshal list body failed")
+	}
+	return ret, nil
+}
+
+// ListAll 递归获取目录下的文件列表，通过 Cursor 和 HasMore 分页
+//
+// RETURNS:
+//   - ListAllReturn: listall return
+//   - error: the return error if any occurs
+func ListAll(accessToken string, arg *ListAllArg) (ListAllReturn, error) {
+	return defaultClient.ListAll(accessToken, arg)
+}
+
+// ListAllWithContext 同 ListAll，ctx取消时中止请求
+func ListAllWithContext(ctx context.Context, accessToken string, arg *ListAllArg) (ListAllReturn, error) {
+	return defaultClient.ListAllWithContext(ctx, accessToken, arg)
+}
+
+// ListAll 使用客户端配置递归获取目录下的文件列表
+func (c *Client) ListAll(accessToken string, arg *ListAllArg) (ListAllReturn, error) {
+	return c.ListAllWithContext(context.Background(), accessToken, arg)
+}
+
+// ListAllWithContext 使用客户端配置递归获取目录下的文件列表，ctx取消时中止请求
+func (c *Client) ListAllWithContext(ctx context.Context, accessToken string, arg *ListAllArg) (ListAllReturn, error) {
+	ret := ListAllReturn{}
+
+	router := "/rest/2.0/xpan/multimedia?method=listall&"
+	uri := c.APIURL(router)
+
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	params.Set("path", arg.Path)
+	if arg.Recursion {
+		params.Set("recursion", "1")
+	}
+	if arg.Order != "" {
+		params.Set("order", arg.Order)
+	}
+	if arg.Desc {
+		params.Set("desc", "1")
+	}
+	params.Set("start", strconv.Itoa(arg.Start))
+	if arg.Limit > 0 {
+		params.Set("limit", strconv.Itoa(arg.Limit))
+	}
+	uri += params.Encode()
+
+	body, status, err := utils.DoHTTPGetWithClient(ctx, c.APIHTTPClient, uri, nil)
+	if err != nil {
+		return ret, err
+	}
+	if err = errno.Check("listall", status, []byte(body)); err != nil {
+		return ret, err
+	}
+	if err = json.Unmarshal([]byte(body), &ret); err != nil {
+		return ret, errors.New("unmarshal listall body failed")
+	}
+	return ret, nil
+}
@@ -0,0 +1,155 @@
+package file
+
+import "encoding/json"
+
+// 排序字段
+const (
+	OrderName = "name"
+	OrderTime = "time"
+	OrderSize = "size"
+)
+
+// 文件或目录信息，list、listall 接口共用
+type FileEntry struct {
+	FsId           uint64 `json:"fs_id"`
+	Path           string `json:"path"`
+	ServerFilename string `json:"server_filename"`
+	Size           uint64 `json:"size"`
+	Isdir          int    `json:"isdir"`
+	Category       int    `json:"category"`
+	Md5            string `json:"md5"`
+	ServerMtime    int64  `json:"server_mtime"`
+	ServerCtime    int64  `json:"server_ctime"`
+	LocalMtime     int64  `json:"local_mtime"`
+	LocalCtime     int64  `json:"local_ctime"`
+	DirEmpty       int    `json:"dir_empty"`
+}
+
+// IsDir 是否为目录
+func (e FileEntry) IsDir() bool {
+	return e.Isdir == 1
+}
+
+// list 参数
+type ListArg struct {
+	Dir        string `json:"dir"`
+	Order      string `json:"order"` // 排序字段，见 OrderXxx，默认按文件名
+	Desc       bool   `json:"desc"`
+	Start      int    `json:"start"`
+	Limit      int    `json:"limit"` // 默认1000，最大1000
+	FolderOnly bool   `json:"folder"`
+	ShowEmpty  bool   `json:"showempty"`
+}
+
+// 创建 ListArg 实例
+func NewListArg(dir string, start int, limit int) *ListArg {
+	s := new(ListArg)
+	s.Dir = dir
+	s.Start = start
+	s.Limit = limit
+	return s
+}
+
+// ListReturn
+type ListReturn struct {
+	Errno     int         `json:"errno"`
+	List      []FileEntry `json:"list"`
+	RequestId json.Number `json:"request_id"`
+}
+
+// listall 参数
+type ListAllArg struct {
+	Path      string `json:"path"`
+	Recursion bool   `json:"recursion"` // 是否递归列出子目录
+	Order     string `json:"order"`
+	Desc      bool   `json:"desc"`
+	Start     int    `json:"start"`
+	Limit     int    `json:"limit"` // 默认1000，最大1000
+}
+
+// 创建 ListAllArg 实例
+func NewListAllArg(path string, recursion bool, start int, limit int) *ListAllArg {
+	s := new(ListAllArg)
+	s.Path = path
+	s.Recursion = recursion
+	s.Start = start
+	s.Limit = limit
+	return s
+}
+
+// ListAllReturn
+type ListAllReturn struct {
+	Errno     int         `json:"errno"`
+	Cursor    int         `json:"cursor"`   // 下一页的起始位置
+	HasMore   int         `json:"has_more"` // 是否还有下一页
+	List      []FileEntry `json:"list"`
+	RequestId json.Number `json:"request_id"`
+}
+
+// filemetas 参数
+type FileMetasArg struct {
+	FsIds     []uint64 `json:"fsids"`
+	Dlink     bool     `json:"dlink"` // 是否返回下载地址
+	Thumb     bool     `json:"thumb"`
+	Extra     bool     `json:"extra"`
+	NeedMedia bool     `json:"needmedia"`
+}
+
+// 创建 FileMetasArg 实例
+func NewFileMetasArg(fsIds []uint64, dlink bool) *FileMetasArg {
+	s := new(FileMetasArg)
+	s.FsIds = fsIds
+	s.Dlink = dlink
+	return s
+}
+
+// 文件元信息
+type FileMeta struct {
+	FsId        uint64 `json:"fs_id"`
+	Path        string `json:"path"`
+	Filename    string `json:"filename"`
+	Size        uint64 `json:"size"`
+	Isdir       int    `json:"isdir"`
+	Category    int    `json:"category"`
+	Md5         string `json:"md5"`
+	Dlink       string `json:"dlink"` // 下载地址，请求时 Dlink 为true才返回
+	ServerMtime int64  `json:"server_mtime"`
+	ServerCtime int64  `json:"server_ctime"`
+	LocalMtime  int64  `json:"local_mtime"`
+	LocalCtime  int64  `json:"local_ctime"`
+}
+
+// IsDir 是否为目录
+func (m FileMeta) IsDir() bool {
+	return m.Isdir == 1
+}
+
+// FileMetasReturn
+type FileMetasReturn struct {
+	Errno     int         `json:"errno"`
+	ErrMsg    string      `json:"errmsg"`
+	List      []FileMeta  `json:"list"`
+	RequestId json.Number `json:"request_id"`
+}
+
+// 创建目录参数
+type CreateDirArg struct {
+	Path string `json:"path"`
+}
+
+// 创建 CreateDirArg 实例
+func NewCreateDirArg(path string) *CreateDirArg {
+	s := new(CreateDirArg)
+	s.Path = path
+	return s
+}
+
+// CreateDirReturn
+type CreateDirReturn struct {
+	Errno int    `json:"errno"`
+	FsId  uint64 `json:"fs_id"`
+	Path  string `json:"path"`
+	Ctime int64  `json:"ctime"`
+	Mtime int64  `json:"mtime"`
+	Isdir int    `json:"isdir"`
+}
@@ -0,0 +1,18 @@
+package filemanager
+
+import (
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// Client 文件管理客户端，可通过 utils.Option 自定义HTTP客户端与服务地址
+type Client struct {
+	*utils.Client
+}
+
+// 创建 Client 实例
+func NewClient(opts ...utils.Option) *Client {
+	return &Client{Client: utils.NewClient(opts...)}
+}
+
+// 包级函数使用的默认客户端
+var defaultClient = NewClient()
@@ -0,0 +1,134 @@
+package filemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// Copy 批量复制文件
+//
+// 部分文件失败时返回的错误满足 errors.Is(err, errno.ErrBatchFailed)，
+// 此时 ManageReturn.Info 中包含每个文件的结果
+func Copy(accessToken string, arg *CopyArg) (ManageReturn, error) {
+	return defaultClient.Copy(accessToken, arg)
+}
+
+// CopyWithContext 同 Copy，ctx取消时中止请求
+func CopyWithContext(ctx context.Context, accessToken string, arg *CopyArg) (ManageReturn, error) {
+	return defaultClient.CopyWithContext(ctx, accessToken, arg)
+}
+
+// Copy 使用客户端配置批量复制文件
+func (c *Client) Copy(accessToken string, arg *CopyArg) (ManageReturn, error) {
+	return c.CopyWithContext(context.Background(), accessToken, arg)
+}
+
+// CopyWithContext 使用客户端配置批量复制文件，ctx取消时中止请求
+func (c *Client) CopyWithContext(ctx context.Context, accessToken string, arg *CopyArg) (ManageReturn, error) {
+	return c.manage(ctx, accessToken, "copy", arg.Async, arg.Ondup, arg.FileList)
+}
+
+// Move 批量移动文件，错误处理同 Copy
+func Move(accessToken string, arg *MoveArg) (ManageReturn, error) {
+	return defaultClient.Move(accessToken, arg)
+}
+
+// MoveWithContext 同 Move，ctx取消时中止请求
+func MoveWithContext(ctx context.Context, accessToken string, arg *MoveArg) (ManageReturn, error) {
+	return defaultClient.MoveWithContext(ctx, accessToken, arg)
+}
+
+// Move 使用客户端配置批量移动文件
+func (c *Client) Move(accessToken string, arg *MoveArg) (ManageReturn, error) {
+	return c.MoveWithContext(context.Background(), accessToken, arg)
+}
+
+// MoveWithContext 使用客户端配置批量移动文件，ctx取消时中止请求
+func (c *Client) MoveWithContext(ctx context.Context, accessToken string, arg *MoveArg) (ManageReturn, error) {
+	return c.manage(ctx, accessToken, "move", arg.Async, arg.Ondup, arg.FileList)
+}
+
+// Rename 批量重命名文件，错误处理同 Copy
+func Rename(accessToken string, arg *RenameArg) (ManageReturn, error) {
+	return defaultClient.Rename(accessToken, arg)
+}
+
+// RenameWithContext 同 Rename，ctx取消时中止请求
+func RenameWithContext(ctx context.Context, accessToken string, arg *RenameArg) (ManageReturn, error) {
+	return defaultClient.RenameWithContext(ctx, accessToken, arg)
+}
+
+// Rename 使用客户端配置批量重命名文件
+func (c *Client) Rename(accessToken string, arg *RenameArg) (ManageReturn, error) {
+	return c.RenameWithContext(context.Background(), accessToken, arg)
+}
+
+// RenameWithContext 使用客户端配置批量重命名文件，ctx取消时中止请求
+func (c *Client) RenameWithContext(ctx context.Context, accessToken string, arg *RenameArg) (ManageReturn, error) {
+	return c.manage(ctx, accessToken, "rename", arg.Async, arg.Ondup, arg.FileList)
+}
+
+// Delete 批量删除文件，错误处理同 Copy
+func Delete(accessToken string, arg *DeleteArg) (ManageReturn, error) {
+	return defaultClient.Delete(accessToken, arg)
+}
+
+// DeleteWithContext 同 Delete，ctx取消时中止请求
+func DeleteWithContext(ctx context.Context, accessToken string, arg *DeleteArg) (ManageReturn, error) {
+	return defaultClient.DeleteWithContext(ctx, accessToken, arg)
+}
+
+// Delete 使用客户端配置批量删除文件
+func (c *Client) Delete(accessToken string, arg *DeleteArg) (ManageReturn, error) {
+	return c.DeleteWithContext(context.Background(), accessToken, arg)
+}
+
+// DeleteWithContext 使用客户端配置批量删除文件，ctx取消时中止请求
+func (c *Client) DeleteWithContext(ctx context.Context, accessToken string, arg *DeleteArg) (ManageReturn, error) {
+	return c.manage(ctx, accessToken, "delete", arg.Async, "", arg.FileList)
+}
+
+// 调用filemanager接口，opera 为 copy、move、rename 或 delete
+func (c *Client) manage(ctx context.Context, accessToken string, opera string, async int, ondup string, fileList interface{}) (ManageReturn, error) {
+	ret := ManageReturn{}
+
+	router := "/rest/2.0/xpan/file?method=filemanager&"
+	uri := c.APIURL(router)
+
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	params.Set("opera", opera)
+	uri += params.Encode()
+
+	postBody := url.Values{}
+	postBody.Add("async", strconv.Itoa(async))
+	fileListJson, _ := json.Marshal(fileList)
+	postBody.Add("filelist", string(fileListJson))
+	if ondup != "" {
+		postBody.Add("ondup", ondup)
+	}
+
+	body, status, err := utils.DoHTTPRequestWithClient(ctx, c.APIHTTPClient, uri, strings.NewReader(postBody.Encode()), headers)
+	if err != nil {
+		return ret, err
+	}
+	// 部分失败时也解析响应，便于调用方查看每个文件的结果
+	if jsonErr := json.Unmarshal([]byte(body), &ret); jsonErr != nil && status < 400 {
+		return ret, errors.New("unmarshal filemanager body failed")
+	}
+	if err = errno.Check("filemanager "+opera, status, []byte(body)); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,108 @@
+package filemanager
+
+import "encoding/json"
+
+// 同步/异步模式
+const (
+	AsyncSync     = 0 // 同步，等待操作完成后返回
+	AsyncAdaptive = 1 // 自适应，由服务端决定
+	AsyncAsync    = 2 // 异步，立即返回taskid
+)
+
+// 目标路径已存在文件时的处理方式
+const (
+	OndupFail      = "fail"      // 返回失败
+	OndupNewCopy   = "newcopy"   // 重命名后保存
+	OndupOverwrite = "overwrite" // 覆盖
+	OndupSkip      = "skip"      // 跳过
+)
+
+// 复制或移动的文件
+type CopyItem struct {
+	Path    string `json:"path"`
+	Dest    string `json:"dest"`    // 目标目录
+	Newname string `json:"newname"` // 目标文件名
+	Ondup   string `json:"ondup,omitempty"`
+}
+
+// 重命名的文件
+type RenameItem struct {
+	Path    string `json:"path"`
+	Newname string `json:"newname"`
+}
+
+// copy 参数
+type CopyArg struct {
+	Async    int        `json:"async"`
+	Ondup    string     `json:"ondup"`
+	FileList []CopyItem `json:"filelist"`
+}
+
+// 创建 CopyArg 实例
+func NewCopyArg(fileList []CopyItem, async int, ondup string) *CopyArg {
+	s := new(CopyArg)
+	s.FileList = fileList
+	s.Async = async
+	s.Ondup = ondup
+	return s
+}
+
+// move 参数
+type MoveArg struct {
+	Async    int        `json:"async"`
+	Ondup    string     `json:"ondup"`
+	FileList []CopyItem `json:"filelist"`
+}
+
+// 创建 MoveArg 实例
+func NewMoveArg(fileList []CopyItem, async int, ondup string) *MoveArg {
+	s := new(MoveArg)
+	s.FileList = fileList
+	s.Async = async
+	s.Ondup = ondup
+	return s
+}
+
+// rename 参数
+type RenameArg struct {
+	Async    int          `json:"async"`
+	Ondup    string       `json:"ondup"`
+	FileList []RenameItem `json:"filelist"`
+}
+
+// 创建 RenameArg 实例
+func NewRenameArg(fileList []RenameItem, async int, ondup string) *RenameArg {
+	s := new(RenameArg)
+	s.FileList = fileList
+	s.Async = async
+	s.Ondup = ondup
+	return s
+}
+
+// delete 参数
+type DeleteArg struct {
+	Async    int      `json:"async"`
+	FileList []string `json:"filelist"` // 要删除的文件路径
+}
+
+// 创建 DeleteArg 实例
+func NewDeleteArg(fileList []string, async int) *DeleteArg {
+	s := new(DeleteArg)
+	s.FileList = fileList
+	s.Async = async
+	return s
+}
+
+// 单个文件的操作结果
+type ManageInfo struct {
+	Errno int    `json:"errno"`
+	Path  string `json:"path"`
+}
+
+// ManageReturn
+type ManageReturn struct {
+	Errno     int          `json:"errno"`
+	Info      []ManageInfo `json:"info"`   // 同步模式下每个文件的操作结果
+	TaskId    json.Number  `json:"taskid"` // 异步模式下的任务ID
+	RequestId json.Number  `json:"request_id"`
+}
@@ -1,12 +1,14 @@
 package upload
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/url"
 	"strconv"
 	"strings"
 
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
 	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
 )
 
@@ -16,15 +18,27 @@ import (
 //   - CreateReturn: create return
 //   - error: the return error if any occurs
 func Create(accessToken string, arg *CreateArg) (CreateReturn, error) {
+	return defaultClient.Create(accessToken, arg)
+}
+
+// CreateWithContext 同 Create，ctx取消时中止请求
+func CreateWithContext(ctx context.Context, accessToken string, arg *CreateArg) (CreateReturn, error) {
+	return defaultClient.CreateWithContext(ctx, accessToken, arg)
+}
+
+// Create 使用客户端配置调用create
+func (c *Client) Create(accessToken string, arg *CreateArg) (CreateReturn, error) {
+	return c.CreateWithContext(context.Background(), accessToken, arg)
+}
+
+// CreateWithContext 使用客户端配置调用create，ctx取消时中止请求
+func (c *Client) CreateWithContext(ctx context.Context, accessToken string, arg *CreateArg) (CreateReturn, error) {
 	ret := CreateReturn{}
 
-	protocal := "https"
-	host := "pan.baidu.com"
 	router := "/rest/2.0/xpan/file?method=create&"
-	uri := protocal + "://" + host + router
+	uri := c.APIURL(router)
 
 	headers := map[string]string{
-		"Host":         host,
 		"Content-Type": "application/x-www-form-urlencoded",
 	}
 
@@ -33,27 +47,31 @@ func Create(accessToken string, arg *CreateArg) (CreateReturn, error) {
 	uri += params.Encode()
 
 	postBody := url.Values{}
-	postBody.Add("rtype", "2")
+	rtype := arg.Rtype
+	if rtype == "" {
+		rtype = RtypeRenameIfDiff
+	}
+	postBody.Add("rtype", rtype)
 	postBody.Add("path", arg.Path)
 	postBody.Add("size", strconv.FormatUint(arg.Size, 10))
 	postBody.Add("isdir", "0")
 	js, _ := json.Marshal(arg.BlockList)
 	postBody.Add("block_list", string(js))
 	postBody.Add("uploadid", arg.UploadId)
+	if arg.LocalMtime > 0 {
+		postBody.Add("local_mtime", strconv.FormatInt(arg.LocalMtime, 10))
+	}
 
-	var body string
-	var err error
-
-	body, _, err = utils.DoHTTPRequest(uri, strings.NewReader(postBody.Encode()), headers)
+	body, status, err := utils.DoHTTPRequestWithClient(ctx, c.APIHTTPClient, uri, strings.NewReader(postBody.Encode()), headers)
 	if err != nil {
 		return ret, err
 	}
+	if err = errno.Check("create", status, []byte(body)); err != nil {
+		return ret, err
+	}
 	if err = json.Unmarshal([]byte(body), &ret); err != nil {
 		return ret, errors.New("unmarshal create body failed")
 	}
-	if ret.Errno != 0 {
-		return ret, errors.New("call create failed")
-	}
 	return ret, nil
 
 }
@@ -1,12 +1,14 @@
 package upload
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/url"
 	"strconv"
 	"strings"
 
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
 	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
 )
 
@@ -16,19 +18,31 @@ import (
 //   - PrecreateReturn: precreate return
 //   - error: the return error if any occurs
 func Precreate(accessToken string, arg *PrecreateArg) (PrecreateReturn, error) {
+	return defaultClient.Precreate(accessToken, arg)
+}
+
+// PrecreateWithContext 同 Precreate，ctx取消时中止请求
+func PrecreateWithContext(ctx context.Context, accessToken string, arg *PrecreateArg) (PrecreateReturn, error) {
+	return defaultClient.PrecreateWithContext(ctx, accessToken, arg)
+}
+
+// Precreate 使用客户端配置调用precreate
+func (c *Client) Precreate(accessToken string, arg *PrecreateArg) (PrecreateReturn, error) {
+	return c.PrecreateWithContext(context.Background(), accessToken, arg)
+}
+
+// PrecreateWithContext 使用客户端配置调用precreate，ctx取消时中止请求
+func (c *Client) PrecreateWithContext(ctx context.Context, accessToken string, arg *PrecreateArg) (PrecreateReturn, error) {
 	ret := PrecreateReturn{}
 
-	protocal := "https"
-	host := "pan.baidu.com"
 	router := "/rest/2.0/xpan/file?method=precreate&"
-	uri := protocal + "://" + host + router
+	uri := c.APIURL(router)
 
 	params := url.Values{}
 	params.Set("access_token", accessToken)
 	uri += params.Encode()
 
 	headers := map[string]string{
-		"Host":         host,
 		"Content-Type": "application/x-www-form-urlencoded",
 	}
 
@@ -39,18 +53,25 @@ func Precreate(accessToken string, arg *PrecreateArg) (PrecreateReturn, error) {
 	postBody.Add("block_list", string(blockListJson))
 	postBody.Add("isdir", "0")
 	postBody.Add("autoinit", "1")
-	// 当path冲突且block_list不同时，进行重命名
-	postBody.Add("rtype", "2")
+	// 默认当path冲突且block_list不同时，进行重命名
+	rtype := arg.Rtype
+	if rtype == "" {
+		rtype = RtypeRenameIfDiff
+	}
+	postBody.Add("rtype", rtype)
+	if arg.LocalMtime > 0 {
+		postBody.Add("local_mtime", strconv.FormatInt(arg.LocalMtime, 10))
+	}
 
-	body, _, err := utils.DoHTTPRequest(uri, strings.NewReader(postBody.Encode()), headers)
+	body, status, err := utils.DoHTTPRequestWithClient(ctx, c.APIHTTPClient, uri, strings.NewReader(postBody.Encode()), headers)
 	if err != nil {
 		return ret, err
 	}
+	if err = errno.Check("precreate", status, []byte(body)); err != nil {
+		return ret, err
+	}
 	if err = json.Unmarshal([]byte(body), &ret); err != nil {
 		return ret, errors.New("unmarshal precreate body failed,body")
 	}
-	if ret.Errno != 0 {
-		return ret, errors.New("call precreate failed")
-	}
 	return ret, nil
 }
@@ -0,0 +1,87 @@
+package upload
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// 秒传要求文件大小至少为 256KB，slice-md5 为文件前 256KB 的MD5
+const RapidUploadSliceSize = 256 * 1024
+
+// RapidUpload 秒传，服务端已有相同内容的文件时无需上传文件数据直接创建文件。
+// 服务端没有该文件时返回的错误满足 errors.Is(err, errno.ErrRapidUploadMiss)
+//
+// RETURNS:
+//   - RapidUploadReturn: rapidupload return
+//   - error: the return error if any occurs
+func RapidUpload(accessToken string, arg *RapidUploadArg) (RapidUploadReturn, error) {
+	return defaultClient.RapidUpload(accessToken, arg)
+}
+
+// RapidUploadWithContext 同 RapidUpload，ctx取消时中止请求
+func RapidUploadWithContext(ctx context.Context, accessToken string, arg *RapidUploadArg) (RapidUploadReturn, error) {
+	return defaultClient.RapidUploadWithContext(ctx, accessToken, arg)
+}
+
+// RapidUpload 使用客户端配置调用rapidupload
+func (c *Client) RapidUpload(accessToken string, arg *RapidUploadArg) (RapidUploadReturn, error) {
+	return c.RapidUploadWithContext(context.Background(), accessToken, arg)
+}
+
+// RapidUploadWithContext 使用客户端配置调用rapidupload，ctx取消时中止请求
+func (c *Client) RapidUploadWithContext(ctx context.Context, accessToken string, arg *RapidUploadArg) (RapidUploadReturn, error) {
+	ret := RapidUploadReturn{}
+
+	router := "/rest/2.0/xpan/file?method=rapidupload&"
+	uri := c.APIURL(router)
+
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	}
+
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	uri += params.Encode()
+
+	postBody := url.Values{}
+	postBody.Add("path", arg.Path)
+	postBody.Add("content-length", strconv.FormatUint(arg.ContentLength, 10))
+	postBody.Add("content-md5", arg.ContentMd5)
+	postBody.Add("slice-md5", arg.SliceMd5)
+	// 默认路径冲突时返回错误，由调用方决定是否走普通上传流程
+	rtype := arg.Rtype
+	if rtype == "" {
+		rtype = RtypeFail
+	}
+	postBody.Add("rtype", rtype)
+	if arg.LocalMtime > 0 {
+		postBody.Add("local_mtime", strconv.FormatInt(arg.LocalMtime, 10))
+	}
+
+	body, status, err := utils.DoHTTPRequestWithClient(ctx, c.APIHTTPClient, uri, strings.NewReader(postBody.Encode()), headers)
+	if err != nil {
+		return ret, err
+	}
+	if err = errno.Check("rapidupload", status, []byte(body)); err != nil {
+		// rapidupload 以errno 404表示服务端没有该文件，其他接口的404含义不同，不能放在全局错误码表中
+		var apiErr *errno.APIError
+		if errors.As(err, &apiErr) && apiErr.Errno == 404 {
+			apiErr.Kind = errno.ErrRapidUploadMiss
+			if apiErr.Message == "" {
+				apiErr.Message = "秒传未命中"
+			}
+		}
+		return ret, err
+	}
+	if err = json.Unmarshal([]byte(body), &ret); err != nil {
+		return ret, errors.New("unmarshal rapidupload body failed")
+	}
+	return ret, nil
+}
@@ -1,10 +1,22 @@
 package upload
 
+import "io"
+
+// 文件名冲突时的处理策略（rtype）
+const (
+	RtypeFail         = "0" // 返回错误
+	RtypeRename       = "1" // 重命名
+	RtypeRenameIfDiff = "2" // block_list不同时重命名，相同时视为已存在
+	RtypeOverwrite    = "3" // 覆盖
+)
+
 // precreate 参数
 type PrecreateArg struct {
-	Path      string   `json:"path"`
-	Size      uint64   `json:"size"`
-	BlockList []string `json:"block_list"`
+	Path       string   `json:"path"`
+	Size       uint64   `json:"size"`
+	BlockList  []string `json:"block_list"`
+	Rtype      string   `json:"rtype"`       // 为空时使用 RtypeRenameIfDiff
+	LocalMtime int64    `json:"local_mtime"` // 本地文件修改时间（秒），为0时不传
 }
 
 // 创建 PrecreateArg 实例
@@ -25,6 +37,36 @@ type PrecreateReturn struct {
 	RequestId  int    `json:"request_id"`
 }
 
+// rapidupload 参数
+type RapidUploadArg struct {
+	Path          string `json:"path"`
+	ContentLength uint64 `json:"content-length"`
+	ContentMd5    string `json:"content-md5"` // 整个文件的MD5
+	SliceMd5      string `json:"slice-md5"`   // 文件前256KB的MD5
+	Rtype         string `json:"rtype"`       // 为空时使用 RtypeFail
+	LocalMtime    int64  `json:"local_mtime"` // 本地文件修改时间（秒），为0时不传
+}
+
+// 创建 RapidUploadArg 实例
+func NewRapidUploadArg(path string, contentLength uint64, contentMd5 string, sliceMd5 string) *RapidUploadArg {
+	s := new(RapidUploadArg)
+	s.Path = path
+	s.ContentLength = contentLength
+	s.ContentMd5 = contentMd5
+	s.SliceMd5 = sliceMd5
+	return s
+}
+
+// RapidUploadReturn
+type RapidUploadReturn struct {
+	Errno     int    `json:"errno"`
+	Path      string `json:"path"`
+	FsId      uint64 `json:"fs_id"`
+	Size      uint64 `json:"size"`
+	Md5       string `json:"md5"`
+	RequestId int    `json:"request_id"`
+}
+
 // upload 参数
 type UploadArg struct {
 	UploadId  string `json:"uploadid"`
@@ -43,6 +85,28 @@ func NewUploadArg(uploadId string, path string, localFile string, partseq int) *
 	return s
 }
 
+// 流式上传分片参数，分片内容为 Reader 中 [Offset, Offset+Size) 的数据
+type UploadPartArg struct {
+	UploadId string      `json:"uploadid"`
+	Path     string      `json:"path"`
+	Partseq  int         `json:"partseq"`
+	Reader   io.ReaderAt `json:"-"`
+	Offset   int64       `json:"offset"`
+	Size     int64       `json:"size"`
+}
+
+// 创建 UploadPartArg 实例
+func NewUploadPartArg(uploadId string, path string, partseq int, reader io.ReaderAt, offset int64, size int64) *UploadPartArg {
+	s := new(UploadPartArg)
+	s.UploadId = uploadId
+	s.Path = path
+	s.Partseq = partseq
+	s.Reader = reader
+	s.Offset = offset
+	s.Size = size
+	return s
+}
+
 // UploadReturn
 type UploadReturn struct {
 	Md5       string `json:"md5"`
@@ -51,10 +115,12 @@ type UploadReturn struct {
 
 // create 参数
 type CreateArg struct {
-	UploadId  string   `json:"uploadid"`
-	Path      string   `json:"path"`
-	Size      uint64   `json:"size"`
-	BlockList []string `json:"block_list"`
+	UploadId   string   `json:"uploadid"`
+	Path       string   `json:"path"`
+	Size       uint64   `json:"size"`
+	BlockList  []string `json:"block_list"`
+	Rtype      string   `json:"rtype"`       // 为空时使用 RtypeRenameIfDiff，应与precreate一致
+	LocalMtime int64    `json:"local_mtime"` // 本地文件修改时间（秒），为0时不传
 }
 
 // 创建 CreateArg 实例
@@ -71,4 +137,5 @@ func NewCreateArg(uploadId string, path string, size uint64, blockList []string)
 type CreateReturn struct {
 	Errno int    `json:"errno"`
 	Path  string `json:"path"`
+	FsId  uint64 `json:"fs_id"`
 }
@@ -2,6 +2,7 @@ package upload
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
@@ -10,53 +11,84 @@ import (
 	"os"
 	"strconv"
 
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
 	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
 )
 
 func Upload(accessToken string, arg *UploadArg) (UploadReturn, error) {
-	ret := UploadReturn{}
+	return defaultClient.Upload(accessToken, arg)
+}
+
+// UploadWithContext 同 Upload，ctx取消时中止请求
+func UploadWithContext(ctx context.Context, accessToken string, arg *UploadArg) (UploadReturn, error) {
+	return defaultClient.UploadWithContext(ctx, accessToken, arg)
+}
 
+// Upload 使用客户端配置上传分片
+func (c *Client) Upload(accessToken string, arg *UploadArg) (UploadReturn, error) {
+	return c.UploadWithContext(context.Background(), accessToken, arg)
+}
+
+// UploadWithContext 使用客户端配置上传分片，ctx取消时中止请求
+func (c *Client) UploadWithContext(ctx context.Context, accessToken string, arg *UploadArg) (UploadReturn, error) {
 	//打开文件句柄操作
 	fileHandle, err := os.Open(arg.LocalFile)
 	if err != nil {
-		return ret, errors.New("superfile2 open file failed")
+		return UploadReturn{}, errors.New("superfile2 open file failed")
 	}
 	defer fileHandle.Close()
 
 	// 获取文件当前信息
 	fileInfo, err := fileHandle.Stat()
 	if err != nil {
-		return ret, err
+		return UploadReturn{}, err
 	}
 
-	// 读取文件块
-	buf := make([]byte, fileInfo.Size())
-	n, err := fileHandle.Read(buf)
-	if err != nil {
-		if err != io.EOF {
-			return ret, err
-		}
-	}
+	partArg := NewUploadPartArg(arg.UploadId, arg.Path, arg.Partseq, fileHandle, 0, fileInfo.Size())
+	return c.UploadPartWithContext(ctx, accessToken, partArg)
+}
+
+// UploadPart 流式上传分片，分片数据直接从 arg.Reader 读取，不在内存或磁盘中缓存整个分片
+func UploadPart(accessToken string, arg *UploadPartArg) (UploadReturn, error) {
+	return defaultClient.UploadPart(accessToken, arg)
+}
+
+// UploadPartWithContext 同 UploadPart，ctx取消时中止请求
+func UploadPartWithContext(ctx context.Context, accessToken string, arg *UploadPartArg) (UploadReturn, error) {
+	return defaultClient.UploadPartWithContext(ctx, accessToken, arg)
+}
 
+// UploadPart 使用客户端配置流式上传分片
+func (c *Client) UploadPart(accessToken string, arg *UploadPartArg) (UploadReturn, error) {
+	return c.UploadPartWithContext(context.Background(), accessToken, arg)
+}
+
+// UploadPartWithContext 使用客户端配置流式上传分片，ctx取消时中止请求
+func (c *Client) UploadPartWithContext(ctx context.Context, accessToken string, arg *UploadPartArg) (UploadReturn, error) {
+	ret := UploadReturn{}
+
+	// 预先生成multipart的头部和尾部，请求体为 头部 + 分片数据 + 尾部
 	bodyBuf := &bytes.Buffer{}
 	bodyWriter := multipart.NewWriter(bodyBuf)
-	fileWriter, err := bodyWriter.CreateFormFile("file", "file")
-	if err != nil {
+	if _, err := bodyWriter.CreateFormFile("file", "file"); err != nil {
 		return ret, err
 	}
+	head := append([]byte(nil), bodyBuf.Bytes()...)
+	bodyBuf.Reset()
+	bodyWriter.Close()
+	tail := bodyBuf.Bytes()
 
-	//iocopy
-	_, err = io.Copy(fileWriter, bytes.NewReader(buf[0:n]))
-	if err != nil {
-		return ret, err
+	newBody := func() io.Reader {
+		return io.MultiReader(
+			bytes.NewReader(head),
+			io.NewSectionReader(arg.Reader, arg.Offset, arg.Size),
+			bytes.NewReader(tail),
+		)
 	}
+	contentLength := int64(len(head)) + arg.Size + int64(len(tail))
 
-	bodyWriter.Close()
-
-	protocal := "https"
-	host := "d.pcs.baidu.com"
 	router := "/rest/2.0/pcs/superfile2?method=upload&"
-	uri := protocal + "://" + host + router
+	uri := c.UploadURL(router)
 
 	params := url.Values{}
 	params.Set("access_token", accessToken)
@@ -67,21 +99,27 @@ func Upload(accessToken string, arg *UploadArg) (UploadReturn, error) {
 
 	contentType := bodyWriter.FormDataContentType()
 	headers := map[string]string{
-		"Host":         host,
 		"Content-Type": contentType,
 	}
 
-	body, _, err := utils.SendHTTPRequest(uri, bodyBuf, headers)
+	body, status, err := utils.SendHTTPStreamWithClient(ctx, c.UploadHTTPClient, uri, newBody, contentLength, headers)
 	if err != nil {
 		return ret, err
 	}
+	if err := errno.Check("superfile2", status, []byte(body)); err != nil {
+		return ret, err
+	}
 	if err := json.Unmarshal([]byte(body), &ret); err != nil {
 		return ret, errors.New("unmarshal body failed")
 
 	}
 	if ret.Md5 == "" {
-		return ret, errors.New("md5 is empty")
-
+		return ret, &errno.APIError{
+			Method:     "superfile2",
+			HTTPStatus: status,
+			RequestID:  strconv.Itoa(ret.RequestId),
+			Message:    "md5 is empty",
+		}
 	}
 	return ret, nil
 }
@@ -0,0 +1,149 @@
+package upload_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/upload"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// 模拟precreate、superfile2和create接口，记录收到的分片内容
+type fakePan struct {
+	t     *testing.T
+	parts map[string]string
+}
+
+func (f *fakePan) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.URL.Query().Get("access_token"); got != "tok" {
+		f.t.Errorf("%s: access_token = %q", r.URL.Path, got)
+	}
+	switch method := r.URL.Query().Get("method"); {
+	case r.URL.Path == "/rest/2.0/xpan/file" && method == "precreate":
+		if err := r.ParseForm(); err != nil {
+			f.t.Fatal(err)
+		}
+		if r.PostForm.Get("path") != "/apps/test/a.txt" || r.PostForm.Get("rtype") != upload.RtypeRenameIfDiff ||
+			r.PostForm.Get("block_list") != `["m0","m1"]` || r.PostForm.Get("autoinit") != "1" {
+			f.t.Errorf("precreate form = %v", r.PostForm)
+		}
+		io.WriteString(w, `{"errno":0,"return_type":1,"block_list":[0,1],"uploadid":"up1","request_id":1}`)
+
+	case r.URL.Path == "/rest/2.0/pcs/superfile2" && method == "upload":
+		if r.URL.Query().Get("uploadid") != "up1" {
+			f.t.Errorf("superfile2 uploadid = %q", r.URL.Query().Get("uploadid"))
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		data, _ := io.ReadAll(file)
+		f.parts[r.URL.Query().Get("partseq")] = string(data)
+		json.NewEncoder(w).Encode(map[string]interface{}{"md5": "md5-" + string(data), "request_id": 2})
+
+	case r.URL.Path == "/rest/2.0/xpan/file" && method == "create":
+		if err := r.ParseForm(); err != nil {
+			f.t.Fatal(err)
+		}
+		if r.PostForm.Get("uploadid") != "up1" || r.PostForm.Get("size") != "10" {
+			f.t.Errorf("create form = %v", r.PostForm)
+		}
+		io.WriteString(w, `{"errno":0,"path":"/apps/test/a.txt","fs_id":42}`)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestClient(t *testing.T, handler http.Handler) *upload.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return upload.NewClient(utils.WithAPIHost(server.URL), utils.WithUploadHost(server.URL))
+}
+
+func TestUploadFlow(t *testing.T) {
+	fake := &fakePan{t: t, parts: make(map[string]string)}
+	client := newTestClient(t, fake)
+	ctx := context.Background()
+
+	pre, err := client.PrecreateWithContext(ctx, "tok", upload.NewPrecreateArg("/apps/test/a.txt", 10, []string{"m0", "m1"}))
+	if err != nil {
+		t.Fatalf("precreate: %v", err)
+	}
+	if pre.UploadId != "up1" || len(pre.BlockList) != 2 {
+		t.Fatalf("precreate = %+v", pre)
+	}
+
+	content := strings.NewReader("helloworld")
+	for seq := 0; seq < 2; seq++ {
+		ret, err := client.UploadPartWithContext(ctx, "tok", upload.NewUploadPartArg(pre.UploadId, "/apps/test/a.txt", seq, content, int64(seq*5), 5))
+		if err != nil {
+			t.Fatalf("superfile2 part %d: %v", seq, err)
+		}
+		if want := "md5-" + []string{"hello", "world"}[seq]; ret.Md5 != want {
+			t.Errorf("part %d md5 = %q, want %q", seq, ret.Md5, want)
+		}
+	}
+	if fake.parts["0"] != "hello" || fake.parts["1"] != "world" {
+		t.Errorf("uploaded parts = %v", fake.parts)
+	}
+
+	created, err := client.CreateWithContext(ctx, "tok", upload.NewCreateArg(pre.UploadId, "/apps/test/a.txt", 10, []string{"m0", "m1"}))
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.FsId != 42 {
+		t.Errorf("create = %+v", created)
+	}
+}
+
+func TestUploadAPIError(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"errno":-10,"request_id":7}`)
+	}))
+
+	_, err := client.Precreate("tok", upload.NewPrecreateArg("/apps/test/a.txt", 10, []string{"m0"}))
+	if !errors.Is(err, errno.ErrQuotaExceeded) {
+		t.Fatalf("precreate error = %v, want ErrQuotaExceeded", err)
+	}
+	var apiErr *errno.APIError
+	if !errors.As(err, &apiErr) || apiErr.Method != "precreate" || apiErr.RequestID != "7" {
+		t.Errorf("precreate error = %#v", err)
+	}
+}
+
+func TestUploadPartMissingMd5(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"request_id":3}`)
+	}))
+
+	_, err := client.UploadPart("tok", upload.NewUploadPartArg("up1", "/apps/test/a.txt", 0, strings.NewReader("x"), 0, 1))
+	var apiErr *errno.APIError
+	if !errors.As(err, &apiErr) || apiErr.Method != "superfile2" {
+		t.Fatalf("superfile2 error = %v, want APIError", err)
+	}
+}
+
+func TestRapidUploadMiss(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"errno":404,"request_id":5}`)
+	}))
+
+	_, err := client.RapidUpload("tok", upload.NewRapidUploadArg("/apps/test/a.txt", 10, "c", "s"))
+	if !errors.Is(err, errno.ErrRapidUploadMiss) {
+		t.Errorf("rapidupload error = %v, want ErrRapidUploadMiss", err)
+	}
+
+	// 其他接口的errno 404不是秒传未命中
+	_, err = client.Precreate("tok", upload.NewPrecreateArg("/apps/test/a.txt", 10, []string{"m0"}))
+	if err == nil || errors.Is(err, errno.ErrRapidUploadMiss) {
+		t.Errorf("precreate error = %v, want a non rapid-upload error", err)
+	}
+}
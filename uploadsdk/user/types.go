@@ -0,0 +1,21 @@
+package user
+
+import "encoding/json"
+
+// 会员类型
+const (
+	VipTypeNormal = 0 // 普通用户
+	VipTypeVip    = 1 // 普通会员
+	VipTypeSVip   = 2 // 超级会员
+)
+
+// InfoReturn
+type InfoReturn struct {
+	Errno       int         `json:"errno"`
+	BaiduName   string      `json:"baidu_name"`
+	NetdiskName string      `json:"netdisk_name"`
+	AvatarUrl   string      `json:"avatar_url"`
+	VipType     int         `json:"vip_type"` // 会员类型，见 VipTypeXxx
+	Uk          uint64      `json:"uk"`
+	RequestId   json.Number `json:"request_id"` // 该接口的request_id可能是字符串或数字
+}
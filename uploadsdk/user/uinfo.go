@@ -0,0 +1,54 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/errno"
+	"icode.baidu.com/baidu/xpan/go-sdk/xpan/utils"
+)
+
+// Info 获取用户信息
+//
+// RETURNS:
+//   - InfoReturn: uinfo return
+//   - error: the return error if any occurs
+func Info(accessToken string) (InfoReturn, error) {
+	return defaultClient.Info(accessToken)
+}
+
+// InfoWithContext 同 Info，ctx取消时中止请求
+func InfoWithContext(ctx context.Context, accessToken string) (InfoReturn, error) {
+	return defaultClient.InfoWithContext(ctx, accessToken)
+}
+
+// Info 使用客户端配置获取用户信息
+func (c *Client) Info(accessToken string) (InfoReturn, error) {
+	return c.InfoWithContext(context.Background(), accessToken)
+}
+
+// InfoWithContext 使用客户端配置获取用户信息，ctx取消时中止请求
+func (c *Client) InfoWithContext(ctx context.Context, accessToken string) (InfoReturn, error) {
+	ret := InfoReturn{}
+
+	router := "/rest/2.0/xpan/nas?method=uinfo&"
+	uri := c.APIURL(router)
+
+	params := url.Values{}
+	params.Set("access_token", accessToken)
+	uri += params.Encode()
+
+	body, status, err := utils.DoHTTPGetWithClient(ctx, c.APIHTTPClient, uri, nil)
+	if err != nil {
+		return ret, err
+	}
+	if err = errno.Check("uinfo", status, []byte(body)); err != nil {
+		return ret, err
+	}
+	if err = json.Unmarshal([]byte(body), &ret); err != nil {
+		return ret, errors.New("unmarshal uinfo body failed")
+	}
+	return ret, nil
+}
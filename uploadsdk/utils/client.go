@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAPIHost    = "pan.baidu.com"
+	DefaultUploadHost = "d.pcs.baidu.com"
+)
+
+// 默认的API请求超时时间
+const apiTimeout = 5 * time.Second
+
+// 分片上传不限制整体耗时（16MB/32MB的分片在慢速网络上可能需要几分钟），
+// 改为请求超过该时间没有任何进度（发送分片数据或等待响应）时中止，见 SendHTTPStreamWithClient
+const uploadStallTimeout = 60 * time.Second
+
+// 下载的响应体可能很大，不限制整体耗时，只限制等待响应头的时间
+const downloadResponseHeaderTimeout = 30 * time.Second
+
+// 所有默认客户端共享同一个Transport，以便在分片之间复用连接
+var defaultTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+// 下载使用独立的Transport，避免大文件传输受整体超时限制
+var downloadTransport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	MaxIdleConnsPerHost:   16,
+	IdleConnTimeout:       90 * time.Second,
+	ResponseHeaderTimeout: downloadResponseHeaderTimeout,
+}
+
+// Client 保存SDK请求所需的HTTP客户端与服务地址
+type Client struct {
+	// 普通API请求（precreate/create等）使用的HTTP客户端
+	APIHTTPClient *http.Client
+	// 分片上传（superfile2）使用的HTTP客户端
+	UploadHTTPClient *http.Client
+	// 文件下载（dlink）使用的HTTP客户端
+	DownloadHTTPClient *http.Client
+	// API服务地址，如 "https://pan.baidu.com"
+	APIBaseURL string
+	// 上传服务地址，如 "https://d.pcs.baidu.com"
+	UploadBaseURL string
+}
+
+// Option 配置 Client 的选项
+type Option func(*Client)
+
+// WithHTTPClient 使用自定义的 *http.Client 发送所有请求
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.APIHTTPClient = httpClient
+		c.UploadHTTPClient = httpClient
+		c.DownloadHTTPClient = httpClient
+	}
+}
+
+// WithAPIHost 设置API服务地址，可以是 "pan.baidu.com" 或 "http://127.0.0.1:8080"
+func WithAPIHost(host string) Option {
+	return func(c *Client) {
+		c.APIBaseURL = normalizeBaseURL(host)
+	}
+}
+
+// WithUploadHost 设置分片上传服务地址，格式同 WithAPIHost
+func WithUploadHost(host string) Option {
+	return func(c *Client) {
+		c.UploadBaseURL = normalizeBaseURL(host)
+	}
+}
+
+// NewClient 创建 Client 实例
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		APIHTTPClient:      &http.Client{Transport: defaultTransport, Timeout: apiTimeout},
+		UploadHTTPClient:   &http.Client{Transport: defaultTransport},
+		DownloadHTTPClient: &http.Client{Transport: downloadTransport},
+		APIBaseURL:         normalizeBaseURL(DefaultAPIHost),
+		UploadBaseURL:      normalizeBaseURL(DefaultUploadHost),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIURL 拼接API服务的请求地址
+func (c *Client) APIURL(router string) string {
+	return c.APIBaseURL + router
+}
+
+// UploadURL 拼接上传服务的请求地址
+func (c *Client) UploadURL(router string) string {
+	return c.UploadBaseURL + router
+}
+
+// 补全协议并去掉末尾的斜杠
+func normalizeBaseURL(host string) string {
+	host = strings.TrimRight(strings.TrimSpace(host), "/")
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	return host
+}
@@ -2,10 +2,14 @@ package utils
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,58 +22,137 @@ type Request struct {
 }
 
 func DoHTTPRequest(url string, body io.Reader, headers map[string]string) (string, int, error) {
-	timeout := 5 * time.Second
-	retryTimes := 3
-	tr := &http.Transport{
-		MaxIdleConnsPerHost: -1,
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
-	}
-	httpClient := &http.Client{Transport: tr}
-	httpClient.Timeout = timeout
-	req, err := http.NewRequest("POST", url, body)
+	return DoHTTPRequestWithClient(context.Background(), NewClient().APIHTTPClient, url, body, headers)
+}
+
+// for superfile2
+func SendHTTPRequest(url string, body io.Reader, headers map[string]string) (string, int, error) {
+	return SendHTTPRequestWithClient(context.Background(), NewClient().UploadHTTPClient, url, body, headers)
+}
+
+// DoHTTPRequestWithClient 使用指定的HTTP客户端发送POST请求，ctx取消时立即中止
+func DoHTTPRequestWithClient(ctx context.Context, httpClient *http.Client, url string, body io.Reader, headers map[string]string) (string, int, error) {
+	return postWithRetry(ctx, httpClient, url, body, headers)
+}
+
+// SendHTTPRequestWithClient 使用指定的HTTP客户端发送superfile2请求，ctx取消时立即中止
+func SendHTTPRequestWithClient(ctx context.Context, httpClient *http.Client, url string, body io.Reader, headers map[string]string) (string, int, error) {
+	postData, err := ioutil.ReadAll(body)
 	if err != nil {
 		return "", 0, err
 	}
-	// request header
-	for k, v := range headers {
-		req.Header.Add(k, v)
-	}
+	newBody := func() io.Reader { return bytes.NewReader(postData) }
+	return SendHTTPStreamWithClient(ctx, httpClient, url, newBody, int64(len(postData)), headers)
+}
 
-	var resp *http.Response
-	for i := 1; i <= retryTimes; i++ {
-		resp, err = httpClient.Do(req)
-		if err == nil {
-			break
+// SendHTTPStreamWithClient 以流式请求体发送superfile2请求，
+// newBody 每次调用都需返回一个从头开始的新请求体，用于网络错误后的重试。
+// 请求超过 uploadStallTimeout 没有进度时中止并返回 *StallError
+func SendHTTPStreamWithClient(ctx context.Context, httpClient *http.Client, url string, newBody func() io.Reader, contentLength int64, headers map[string]string) (string, int, error) {
+	return sendStream(ctx, httpClient, url, newBody, contentLength, headers, uploadStallTimeout)
+}
+
+// StallError 上传或下载请求长时间没有进度，实现 net.Error，调用方可以按网络超时重试
+type StallError struct {
+	Idle time.Duration // 没有进度的时间
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("request stalled: no progress for %v", e.Idle)
+}
+
+func (e *StallError) Timeout() bool   { return true }
+func (e *StallError) Temporary() bool { return true }
+
+// 发送流式请求，网络错误时最多重试3次；每次读取请求体都会重置计时，
+// 超过stallTimeout没有读取（包括发送完请求体后等待响应）时中止本次请求
+func sendStream(ctx context.Context, httpClient *http.Client, url string, newBody func() io.Reader, contentLength int64, headers map[string]string, stallTimeout time.Duration) (string, int, error) {
+	retryTimes := 3
+	for i := 1; ; i++ {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		var stalled int32
+		timer := time.AfterFunc(stallTimeout, func() {
+			atomic.StoreInt32(&stalled, 1)
+			cancel()
+		})
+		watched := func() io.Reader {
+			return &progressReader{r: newBody(), onRead: func() { timer.Reset(stallTimeout) }}
+		}
+		body, status, err := doWithRetry(attemptCtx, httpClient, "POST", url, watched, contentLength, headers, 1)
+		timer.Stop()
+		cancel()
+		if err != nil && atomic.LoadInt32(&stalled) == 1 && ctx.Err() == nil {
+			err = &StallError{Idle: stallTimeout}
 		}
-		if i == retryTimes {
-			return "", 0, err
+		if err == nil || i == retryTimes || ctx.Err() != nil {
+			return body, status, err
 		}
 	}
+}
 
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
+// 每次读取时调用onRead的Reader
+type progressReader struct {
+	r      io.Reader
+	onRead func()
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.onRead()
+	return n, err
+}
+
+// DoHTTPGetWithClient 使用指定的HTTP客户端发送GET请求，ctx取消时立即中止
+func DoHTTPGetWithClient(ctx context.Context, httpClient *http.Client, url string, headers map[string]string) (string, int, error) {
+	return doWithRetry(ctx, httpClient, "GET", url, nil, 0, headers, 3)
+}
+
+// 发送POST请求，网络错误时最多重试3次
+func postWithRetry(ctx context.Context, httpClient *http.Client, url string, body io.Reader, headers map[string]string) (string, int, error) {
+	// 读出请求体，保证每次重试都能重新发送
+	postData, err := ioutil.ReadAll(body)
 	if err != nil {
-		return "", resp.StatusCode, err
+		return "", 0, err
 	}
-	return string(respBody), resp.StatusCode, nil
+	newBody := func() io.Reader { return bytes.NewReader(postData) }
+	return doWithRetry(ctx, httpClient, "POST", url, newBody, int64(len(postData)), headers, 3)
 }
 
-// for superfile2
-func SendHTTPRequest(url string, body io.Reader, headers map[string]string) (string, int, error) {
-	timeout := 60 * time.Second
-	retryTimes := 3
-	postData, _ := ioutil.ReadAll(body)
+var accessTokenParam = regexp.MustCompile(`(access_token=)[^&\s"]*`)
+
+// RedactAccessToken 将字符串中请求地址的access_token参数替换为***
+func RedactAccessToken(s string) string {
+	return accessTokenParam.ReplaceAllString(s, "${1}***")
+}
+
+// RedactError 去掉网络错误（*url.Error）中请求地址的access_token，
+// 错误信息会被写入日志和任务队列，不能包含token
+func RedactError(err error) error {
+	if e, ok := err.(*url.Error); ok {
+		return &url.Error{Op: e.Op, URL: RedactAccessToken(e.URL), Err: e.Err}
+	}
+	return err
+}
+
+// 发送请求，网络错误时最多尝试retryTimes次，newBody 为nil时不带请求体；
+// 返回的网络错误中不包含access_token
+func doWithRetry(ctx context.Context, httpClient *http.Client, method string, url string, newBody func() io.Reader, contentLength int64, headers map[string]string, retryTimes int) (string, int, error) {
+
 	var resp *http.Response
 	for i := 1; i <= retryTimes; i++ {
-		tr := &http.Transport{
-			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
-			MaxIdleConnsPerHost: -1,
+		var body io.Reader
+		if newBody != nil {
+			body = newBody()
 		}
-		httpClient := &http.Client{Transport: tr}
-		httpClient.Timeout = timeout
-		req, err := http.NewRequest("POST", url, bytes.NewBuffer(postData))
+		req, err := http.NewRequestWithContext(ctx, method, url, body)
 		if err != nil {
-			return "", 0, err
+			return "", 0, RedactError(err)
+		}
+		if newBody != nil {
+			req.ContentLength = contentLength
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(newBody()), nil
+			}
 		}
 		// request header
 		for k, v := range headers {
@@ -79,15 +162,16 @@ func SendHTTPRequest(url string, body io.Reader, headers map[string]string) (str
 		if err == nil {
 			break
 		}
-		if i == retryTimes {
-			return "", 0, err
+		// 已取消的请求不再重试
+		if i == retryTimes || ctx.Err() != nil {
+			return "", 0, RedactError(err)
 		}
 	}
 	defer resp.Body.Close()
+
 	respBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return "", resp.StatusCode, err
 	}
-
 	return string(respBody), resp.StatusCode, nil
 }
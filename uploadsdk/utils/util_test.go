@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 每次读取只返回一个字节并等待delay的请求体，模拟慢速链路
+type slowReader struct {
+	data  string
+	delay time.Duration
+}
+
+func (r *slowReader) Read(b []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	time.Sleep(r.delay)
+	b[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func TestSendStreamSlowButProgressing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	// 总耗时超过stallTimeout，但一直有进度，不应中止
+	newBody := func() io.Reader { return &slowReader{data: "0123456789", delay: 30 * time.Millisecond} }
+	body, _, err := sendStream(context.Background(), server.Client(), server.URL, newBody, 10, nil, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("sendStream: %v", err)
+	}
+	if body != "0123456789" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSendStreamStalled(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		ioutil.ReadAll(r.Body)
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	newBody := func() io.Reader { return strings.NewReader("part") }
+	_, _, err := sendStream(context.Background(), server.Client(), server.URL, newBody, 4, nil, 50*time.Millisecond)
+	var stallErr *StallError
+	if !errors.As(err, &stallErr) {
+		t.Fatalf("err = %v, want *StallError", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("StallError should be a net.Error timeout")
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Errorf("requests = %d, want 3", n)
+	}
+}
+
+func TestNetworkErrorRedactsAccessToken(t *testing.T) {
+	// 监听后立即关闭，连接会被拒绝
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, _, err = DoHTTPGetWithClient(context.Background(), http.DefaultClient, "http://"+addr+"/rest/2.0/xpan/nas?method=uinfo&access_token=secret-token&x=1", nil)
+	if err == nil {
+		t.Fatal("request to a closed port should fail")
+	}
+	if strings.Contains(err.Error(), "secret-token") || !strings.Contains(err.Error(), "access_token=***&x=1") {
+		t.Errorf("error = %v", err)
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		t.Errorf("redacted error %T is no longer a net.Error", err)
+	}
+}
+
+func TestRedactAccessToken(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://pan.baidu.com/rest?access_token=121.abc&method=list": "https://pan.baidu.com/rest?access_token=***&method=list",
+		`Post "https://d.pcs.baidu.com/x?access_token=121.abc": EOF`:  `Post "https://d.pcs.baidu.com/x?access_token=***": EOF`,
+		"no token here": "no token here",
+	} {
+		if got := RedactAccessToken(in); got != want {
+			t.Errorf("RedactAccessToken(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"bddisk_uploader/logger"
+)
+
+const (
+	DefaultWatchDelay  = 5               // 文件停止变化多少秒后开始上传
+	WatchPollInterval  = 2 * time.Second // 无法使用inotify时扫描文件夹的间隔
+	watchCheckInterval = time.Second     // 检查等待中的文件是否已停止变化的间隔
+)
+
+// 等待停止变化的文件
+type pendingFile struct {
+	size      int64
+	modTime   time.Time
+	changedAt time.Time
+}
+
+// 监听时需要跳过的文件和目录：匹配排除模式或位于缓存目录中
+func watchSkipFunc(folderPath, cacheDir string, excludePatterns []string) func(path string) bool {
+	absCacheDir, _ := filepath.Abs(cacheDir)
+	return func(path string) bool {
+		if path == folderPath {
+			return false
+		}
+		if absPath, err := filepath.Abs(path); err == nil && absCacheDir != "" {
+			if absPath == absCacheDir || strings.HasPrefix(absPath, absCacheDir+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return shouldExcludeFile(path, excludePatterns)
+	}
+}
+
+// 扫描文件夹，返回 路径 -> 大小和修改时间
+func scanFolder(folderPath string, skip func(path string) bool) map[string]pendingFile {
+	files := make(map[string]pendingFile)
+	filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if skip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			files[path] = pendingFile{size: info.Size(), modTime: info.ModTime()}
+		}
+		return nil
+	})
+	return files
+}
+
+// 定时扫描文件夹，新增或大小、修改时间变化的文件路径写入返回的通道
+func pollFolder(ctx context.Context, folderPath string, skip func(path string) bool) <-chan string {
+	events := make(chan string, 256)
+	snapshot := scanFolder(folderPath, skip)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(WatchPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current := scanFolder(folderPath, skip)
+			for path, f := range current {
+				if old, ok := snapshot[path]; ok && old.size == f.size && old.modTime.Equal(f.modTime) {
+					continue
+				}
+				select {
+				case events <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+			snapshot = current
+		}
+	}()
+	return events
+}
+
+// 监听文件夹，先同步已有的文件，之后新增或修改的文件在停止变化 delay 后上传，直到ctx取消
+func watchFolderWithCacheDir(ctx context.Context, config *Config, folderPath string, excludePatterns []string, keepStructure bool, maxConcurrent int, cacheDir string, opts *UploadOptions, syncOpts *SyncOptions, delay time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 先开始监听，同步期间发生的变化不会遗漏
+	skip := watchSkipFunc(folderPath, cacheDir, excludePatterns)
+	events, err := watchFolderEvents(ctx, folderPath, skip)
+	if err != nil {
+		return fmt.Errorf("监听文件夹失败: %w", err)
+	}
+
+	if syncOpts == nil {
+		syncOpts = &SyncOptions{}
+	}
+	if err := uploadFolderWithCacheDir(ctx, config, folderPath, excludePatterns, keepStructure, maxConcurrent, cacheDir, opts, syncOpts); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		logger.Warn("同步已有文件未全部成功: %v", err)
+	}
+	flushFileIndex()
+
+	stats := &UploadStats{StartTime: time.Now()}
+	pool := newUploadPool(ctx, config, maxConcurrent, cacheDir, opts, stats)
+	done := make(chan string)
+	pool.onDone = func(fileInfo FileInfo, err error) {
+		flushFileIndex()
+		select {
+		case done <- fileInfo.LocalPath:
+		case <-ctx.Done():
+		}
+	}
+
+	// 并发数已满时submit会阻塞，在单独的goroutine中提交，退出前等待提交结束
+	var submitting sync.WaitGroup
+	stopPool := func() {
+		submitting.Wait()
+		pool.wait()
+		printWatchSummary(stats)
+	}
+
+	pending := make(map[string]*pendingFile)
+	uploading := make(map[string]bool) // 正在上传的文件，上传结束前不会再次提交
+	ticker := time.NewTicker(watchCheckInterval)
+	defer ticker.Stop()
+
+	fmt.Printf("\n👀 正在监听文件夹: %s（文件停止变化 %s 后上传，按 Ctrl-C 退出）\n", folderPath, formatDuration(delay))
+	for {
+		select {
+		case <-ctx.Done():
+			stopPool()
+			return ctx.Err()
+
+		case path, ok := <-events:
+			if !ok {
+				cancel()
+				stopPool()
+				return fmt.Errorf("文件夹监听已停止")
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			logger.Debug("文件变化: %s", path)
+			pending[path] = &pendingFile{size: info.Size(), modTime: info.ModTime(), changedAt: time.Now()}
+
+		case path := <-done:
+			delete(uploading, path)
+
+		case now := <-ticker.C:
+			for path, p := range pending {
+				info, err := os.Stat(path)
+				if err != nil || info.IsDir() {
+					delete(pending, path)
+					continue
+				}
+				// 大小或修改时间仍在变化，说明文件还在写入
+				if info.Size() != p.size || !info.ModTime().Equal(p.modTime) {
+					p.size, p.modTime, p.changedAt = info.Size(), info.ModTime(), now
+					continue
+				}
+				if now.Sub(p.changedAt) < delay || uploading[path] {
+					continue
+				}
+				delete(pending, path)
+
+				fileInfo, err := newFolderFileInfo(folderPath, path, info, keepStructure)
+				if err != nil {
+					logger.Warn("跳过文件 %s: %v", path, err)
+					continue
+				}
+				if e := fileIndex.lookup(path, info); e != nil && e.FsId != 0 && e.RemotePath == resolveRemotePath(config.AppPath, fileInfo.RemotePath) {
+					logger.Debug("文件已上传且未变化，跳过: %s", path)
+					continue
+				}
+
+				uploading[path] = true
+				atomic.AddInt64(&stats.TotalFiles, 1)
+				atomic.AddInt64(&stats.TotalSize, fileInfo.Size)
+				submitting.Add(1)
+				go func() {
+					defer submitting.Done()
+					pool.submit(fileInfo)
+				}()
+			}
+		}
+	}
+}
+
+// 输出监听期间的上传统计
+func printWatchSummary(stats *UploadStats) {
+	uploaded := atomic.LoadInt64(&stats.UploadedFiles)
+	failed := atomic.LoadInt64(&stats.FailedFiles)
+	fmt.Printf("\n监听结束: 上传 %d 个文件 (%s)，失败 %d 个，运行 %s\n",
+		uploaded, formatFileSize(atomic.LoadInt64(&stats.UploadedSize)), failed, formatDuration(time.Since(stats.StartTime)))
+}
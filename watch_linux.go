@@ -0,0 +1,149 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"bddisk_uploader/logger"
+)
+
+// 文件写入完成、移入、新建和修改时通知
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_MODIFY
+
+// 使用inotify监听文件夹及其所有子目录
+type inotifyWatcher struct {
+	file    *os.File
+	fd      int
+	root    string
+	skip    func(path string) bool
+	watches map[int32]string // watch描述符 -> 目录路径
+	events  chan string
+}
+
+// 监听文件夹中新增或修改的文件，路径写入返回的通道；inotify不可用时改为定时扫描
+func watchFolderEvents(ctx context.Context, folderPath string, skip func(path string) bool) (<-chan string, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		logger.Warn("inotify不可用，改为每 %s 扫描一次文件夹: %v", formatDuration(WatchPollInterval), err)
+		return pollFolder(ctx, folderPath, skip), nil
+	}
+
+	w := &inotifyWatcher{
+		// 非阻塞的fd交给Go的poller管理，Close时会唤醒阻塞中的Read
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		root:    folderPath,
+		skip:    skip,
+		watches: make(map[int32]string),
+		events:  make(chan string, 256),
+	}
+	if err := w.addTree(ctx, folderPath, false); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	logger.Debug("已监听 %d 个目录", len(w.watches))
+
+	go func() {
+		<-ctx.Done()
+		w.file.Close()
+	}()
+	go w.run(ctx)
+	return w.events, nil
+}
+
+// 监听目录及其子目录；emit为true时将其中已有的文件也作为变化发出（新建或移入的目录）
+func (w *inotifyWatcher) addTree(ctx context.Context, dir string, emit bool) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			logger.Warn("警告: 访问文件失败 %s: %v", path, err)
+			return nil
+		}
+		if w.skip(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			if emit {
+				w.emit(ctx, path)
+			}
+			return nil
+		}
+
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			if path == w.root {
+				return err
+			}
+			logger.Warn("无法监听目录 %s: %v", path, err)
+			return nil
+		}
+		w.watches[int32(wd)] = path
+		return nil
+	})
+}
+
+func (w *inotifyWatcher) emit(ctx context.Context, path string) {
+	select {
+	case w.events <- path:
+	case <-ctx.Done():
+	}
+}
+
+// 读取并解析inotify事件，直到ctx取消或读取出错
+func (w *inotifyWatcher) run(ctx context.Context) {
+	defer close(w.events)
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("读取文件变化事件失败: %v", err)
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(event.Len)]), "\x00")
+			offset = nameStart + int(event.Len)
+
+			switch {
+			case event.Mask&syscall.IN_Q_OVERFLOW != 0:
+				// 事件队列溢出，可能有变化被丢弃，重新扫描整个文件夹
+				logger.Warn("文件变化事件过多，重新扫描文件夹")
+				if err := w.addTree(ctx, w.root, true); err != nil {
+					logger.Error("重新扫描文件夹失败: %v", err)
+				}
+			case event.Mask&syscall.IN_IGNORED != 0:
+				delete(w.watches, event.Wd)
+			default:
+				dir, ok := w.watches[event.Wd]
+				if !ok || name == "" {
+					continue
+				}
+				path := filepath.Join(dir, name)
+				if w.skip(path) {
+					continue
+				}
+				if event.Mask&syscall.IN_ISDIR != 0 {
+					// 新建或移入的目录，目录中可能已经有文件
+					if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+						w.addTree(ctx, path, true)
+					}
+					continue
+				}
+				w.emit(ctx, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "context"
+
+// 监听文件夹中新增或修改的文件，路径写入返回的通道；非Linux系统定时扫描文件夹
+func watchFolderEvents(ctx context.Context, folderPath string, skip func(path string) bool) (<-chan string, error) {
+	return pollFolder(ctx, folderPath, skip), nil
+}